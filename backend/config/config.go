@@ -3,13 +3,18 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
 
 const DefaultHost = "127.0.0.1"
 const DefaultPort = "5000"
+const DefaultMaxConcurrentTransfers = 4
+const DefaultShutdownTimeout = 30 * time.Second
+const DefaultMaxUploadBytes = 1024 * 1024 * 1024
 
 type Config struct {
 	SecretKey   string `toml:"secret_key"`
@@ -17,6 +22,15 @@ type Config struct {
 	SMTPURI     string `toml:"smtp_uri"`
 	Host        string `toml:"host"`
 	Port        string `toml:"port"`
+
+	MaxBytesPerSecond int `toml:"max_bytes_per_second"`
+
+	MaxConcurrentTransfers int           `toml:"max_concurrent_transfers"`
+	ShutdownTimeout        time.Duration `toml:"shutdown_timeout"`
+
+	MaxUploadBytes int `toml:"max_upload_bytes"`
+
+	AllowedLocalRoots []string `toml:"allowed_local_roots"`
 }
 
 func Read(data string) (Config, error) {
@@ -24,6 +38,11 @@ func Read(data string) (Config, error) {
 	cfg := Config{
 		Host: DefaultHost,
 		Port: DefaultPort,
+
+		MaxConcurrentTransfers: DefaultMaxConcurrentTransfers,
+		ShutdownTimeout:        DefaultShutdownTimeout,
+
+		MaxUploadBytes: DefaultMaxUploadBytes,
 	}
 	meta, err := toml.Decode(data, &cfg)
 	if err != nil {
@@ -69,6 +88,20 @@ func Read(data string) (Config, error) {
 		return Config{}, fmt.Errorf("missing config values: %s", msg)
 	}
 
+	if cfg.MaxConcurrentTransfers < 1 {
+		return Config{}, fmt.Errorf("invalid config value: max_concurrent_transfers must be at least 1")
+	}
+
+	if cfg.MaxUploadBytes < 1 {
+		return Config{}, fmt.Errorf("invalid config value: max_upload_bytes must be at least 1")
+	}
+
+	for _, root := range cfg.AllowedLocalRoots {
+		if !filepath.IsAbs(root) {
+			return Config{}, fmt.Errorf("invalid config value: allowed_local_roots must be absolute paths")
+		}
+	}
+
 	return cfg, nil
 }
 
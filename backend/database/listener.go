@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Bounds on how long to wait before reconnecting a failed listener.
+const (
+	listenerMinBackoff = 1 * time.Second
+	listenerMaxBackoff = 30 * time.Second
+)
+
+// Holds a dedicated connection that LISTENs on a channel so that changes can
+// be acted on as soon as they are NOTIFY'd (instead of on the next poll).
+type Listener struct {
+	logger      *slog.Logger
+	databaseURI string
+	channel     string
+}
+
+func NewListener(logger *slog.Logger, databaseURI, channel string) *Listener {
+	l := Listener{
+		logger:      logger,
+		databaseURI: databaseURI,
+		channel:     channel,
+	}
+	return &l
+}
+
+// Call onNotify with each notification's payload until the context is done,
+// reconnecting whenever the connection fails. An empty payload is sent after
+// each (re)connect since anything sent in the meantime was missed.
+func (l *Listener) Run(ctx context.Context, onNotify func(payload string)) error {
+	backoff := listenerMinBackoff
+	for {
+		err := l.listen(ctx, func(payload string) {
+			// the connection works so start over if it fails later
+			backoff = listenerMinBackoff
+			onNotify(payload)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// log error but keep trying
+		l.logger.Error(err.Error(), "channel", l.channel, "retry_in", backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil
+		}
+
+		backoff = min(backoff*2, listenerMaxBackoff)
+	}
+}
+
+func (l *Listener) listen(ctx context.Context, onNotify func(payload string)) error {
+	conn, err := Connect(l.databaseURI)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{l.channel}.Sanitize())
+	if err != nil {
+		return err
+	}
+
+	l.logger.Info("listening for notifications", "channel", l.channel)
+
+	// anything sent while (re)connecting was missed so check right away
+	onNotify("")
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		onNotify(notification.Payload)
+	}
+}
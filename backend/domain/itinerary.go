@@ -1,17 +1,39 @@
 package domain
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/fileserver"
 )
 
 var (
-	ErrItineraryInvalidPattern = errors.New("itinerary: invalid pattern")
-	ErrItinerarySameLocation   = errors.New("itinerary: same location")
+	ErrItineraryInvalidPattern   = errors.New("itinerary: invalid pattern")
+	ErrItinerarySameLocation     = errors.New("itinerary: same location")
+	ErrItineraryInvalidConflict  = errors.New("itinerary: invalid conflict policy")
+	ErrItineraryInvalidRetry     = errors.New("itinerary: invalid retry policy")
+	ErrItineraryInvalidMarker    = errors.New("itinerary: invalid marker policy")
+	ErrItineraryInvalidBandwidth = errors.New("itinerary: invalid bandwidth limit")
+	ErrItineraryInvalidPriority  = errors.New("itinerary: invalid priority")
+	ErrItineraryInvalidPoll      = errors.New("itinerary: invalid poll interval")
+	ErrItineraryInvalidTimeout   = errors.New("itinerary: invalid timeout")
+	ErrItineraryNoMatchingFiles  = errors.New("itinerary: no matching files")
 )
 
+// Shortest allowed interval between polls of an itinerary's source location.
+const MinPollInterval = 10 * time.Second
+
 // Aggregate with a single entity
 type Itinerary struct {
 	id uuid.UUID
@@ -19,6 +41,20 @@ type Itinerary struct {
 	fromLocationID uuid.UUID
 	toLocationID   uuid.UUID
 	pattern        string
+	conflict       fileserver.ConflictPolicy
+	retry          fileserver.RetryPolicy
+	marker         fileserver.MarkerPolicy
+
+	maxBytesPerSecond int
+	priority          int
+
+	maxDuration time.Duration
+	idleTimeout time.Duration
+
+	pollInterval time.Duration
+	polledAt     time.Time
+
+	triggerSecret string
 
 	createdAt time.Time
 	updatedAt time.Time
@@ -39,6 +75,9 @@ func NewItinerary(from, to *Location, pattern string) (*Itinerary, error) {
 		fromLocationID: from.ID(),
 		toLocationID:   to.ID(),
 		pattern:        pattern,
+		conflict:       fileserver.ConflictOverwrite,
+		retry:          fileserver.DefaultRetryPolicy,
+		marker:         fileserver.DefaultMarkerPolicy,
 
 		createdAt: time.Now(),
 		updatedAt: time.Now(),
@@ -56,6 +95,16 @@ func LoadItinerary(
 	fromLocationID uuid.UUID,
 	toLocationID uuid.UUID,
 	pattern string,
+	conflict fileserver.ConflictPolicy,
+	retry fileserver.RetryPolicy,
+	marker fileserver.MarkerPolicy,
+	maxBytesPerSecond int,
+	priority int,
+	maxDuration time.Duration,
+	idleTimeout time.Duration,
+	pollInterval time.Duration,
+	polledAt time.Time,
+	triggerSecret string,
 	createdAt time.Time,
 	updatedAt time.Time,
 ) *Itinerary {
@@ -65,6 +114,20 @@ func LoadItinerary(
 		fromLocationID: fromLocationID,
 		toLocationID:   toLocationID,
 		pattern:        pattern,
+		conflict:       conflict,
+		retry:          retry,
+		marker:         marker,
+
+		maxBytesPerSecond: maxBytesPerSecond,
+		priority:          priority,
+
+		maxDuration: maxDuration,
+		idleTimeout: idleTimeout,
+
+		pollInterval: pollInterval,
+		polledAt:     polledAt,
+
+		triggerSecret: triggerSecret,
 
 		createdAt: createdAt,
 		updatedAt: updatedAt,
@@ -88,6 +151,272 @@ func (i *Itinerary) Pattern() string {
 	return i.pattern
 }
 
+func (i *Itinerary) Conflict() fileserver.ConflictPolicy {
+	return i.conflict
+}
+
+func (i *Itinerary) SetConflict(conflict fileserver.ConflictPolicy) error {
+	switch conflict {
+	case fileserver.ConflictOverwrite,
+		fileserver.ConflictSkip,
+		fileserver.ConflictFail,
+		fileserver.ConflictOverwriteIfNewer,
+		fileserver.ConflictRenameNumeric,
+		fileserver.ConflictRenameTimestamp:
+	default:
+		return ErrItineraryInvalidConflict
+	}
+
+	i.conflict = conflict
+	return nil
+}
+
+func (i *Itinerary) Retry() fileserver.RetryPolicy {
+	return i.retry
+}
+
+func (i *Itinerary) SetRetry(retry fileserver.RetryPolicy) error {
+	if retry.MaxAttempts < 1 {
+		return ErrItineraryInvalidRetry
+	}
+	if retry.InitialDelay < 0 {
+		return ErrItineraryInvalidRetry
+	}
+	if retry.BackoffFactor < 1 {
+		return ErrItineraryInvalidRetry
+	}
+	if retry.Jitter < 0 || retry.Jitter > 1 {
+		return ErrItineraryInvalidRetry
+	}
+
+	i.retry = retry
+	return nil
+}
+
+// How marker files gate (and signal the delivery of) this itinerary's files.
+func (i *Itinerary) Marker() fileserver.MarkerPolicy {
+	return i.marker
+}
+
+func (i *Itinerary) SetMarker(marker fileserver.MarkerPolicy) error {
+	switch marker.Action {
+	case fileserver.MarkerActionKeep, fileserver.MarkerActionDelete, fileserver.MarkerActionCopy:
+	default:
+		return ErrItineraryInvalidMarker
+	}
+
+	// source markers can only be handled if they are required
+	if marker.Suffix == "" && marker.Action != fileserver.MarkerActionKeep {
+		return ErrItineraryInvalidMarker
+	}
+
+	// markers are plain file names (not paths)
+	if strings.Contains(marker.Suffix, "/") || strings.Contains(marker.Complete, "/") {
+		return ErrItineraryInvalidMarker
+	}
+
+	i.marker = marker
+	return nil
+}
+
+// Maximum throughput (in bytes per second) for transfers of this itinerary
+// (zero means unlimited). Each worker process enforces this separately.
+func (i *Itinerary) MaxBytesPerSecond() int {
+	return i.maxBytesPerSecond
+}
+
+func (i *Itinerary) SetMaxBytesPerSecond(maxBytesPerSecond int) error {
+	if maxBytesPerSecond < 0 {
+		return ErrItineraryInvalidBandwidth
+	}
+
+	i.maxBytesPerSecond = maxBytesPerSecond
+	return nil
+}
+
+// Default priority of this itinerary's transfers (higher runs first).
+func (i *Itinerary) Priority() int {
+	return i.priority
+}
+
+func (i *Itinerary) SetPriority(priority int) error {
+	if priority < MinPriority || priority > MaxPriority {
+		return ErrItineraryInvalidPriority
+	}
+
+	i.priority = priority
+	return nil
+}
+
+// Longest that a single run of this itinerary's transfers may take (zero
+// means no limit).
+func (i *Itinerary) MaxDuration() time.Duration {
+	return i.maxDuration
+}
+
+func (i *Itinerary) SetMaxDuration(maxDuration time.Duration) error {
+	if maxDuration < 0 {
+		return ErrItineraryInvalidTimeout
+	}
+
+	i.maxDuration = maxDuration
+	return nil
+}
+
+// Longest that a file's copy may go without moving any bytes (zero means no
+// limit).
+func (i *Itinerary) IdleTimeout() time.Duration {
+	return i.idleTimeout
+}
+
+func (i *Itinerary) SetIdleTimeout(idleTimeout time.Duration) error {
+	if idleTimeout < 0 {
+		return ErrItineraryInvalidTimeout
+	}
+
+	i.idleTimeout = idleTimeout
+	return nil
+}
+
+// How often to poll the source location for new files (zero means never).
+func (i *Itinerary) PollInterval() time.Duration {
+	return i.pollInterval
+}
+
+func (i *Itinerary) SetPollInterval(pollInterval time.Duration) error {
+	if pollInterval != 0 && pollInterval < MinPollInterval {
+		return ErrItineraryInvalidPoll
+	}
+
+	i.pollInterval = pollInterval
+	return nil
+}
+
+// When the source location was last polled (zero if never).
+func (i *Itinerary) PolledAt() time.Time {
+	return i.polledAt
+}
+
+// Whether or not the source location is due to be polled as of a given time.
+func (i *Itinerary) PollDue(now time.Time) bool {
+	if i.pollInterval == 0 {
+		return false
+	}
+
+	return !i.polledAt.Add(i.pollInterval).After(now)
+}
+
+// Shared secret that external systems use to trigger transfers of this
+// itinerary via webhook (empty means that webhooks are disabled).
+func (i *Itinerary) TriggerSecret() string {
+	return i.triggerSecret
+}
+
+// Enable webhook triggers with a brand new secret (invalidating any old one).
+func (i *Itinerary) RotateTriggerSecret() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	i.triggerSecret = hex.EncodeToString(buf)
+	return i.triggerSecret, nil
+}
+
+func (i *Itinerary) DisableTrigger() error {
+	i.triggerSecret = ""
+	return nil
+}
+
+// Check a webhook's token against the trigger secret.
+func (i *Itinerary) VerifyTriggerToken(token string) bool {
+	if i.triggerSecret == "" || token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(i.triggerSecret)) == 1
+}
+
+// Check a webhook's HMAC-SHA256 signature (hex encoded, optionally prefixed
+// with "sha256=") of the request body against the trigger secret.
+func (i *Itinerary) VerifyTriggerSignature(body []byte, signature string) bool {
+	if i.triggerSecret == "" || signature == "" {
+		return false
+	}
+
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(i.triggerSecret))
+	mac.Write(body)
+	want := mac.Sum(nil)
+
+	return hmac.Equal(got, want)
+}
+
+// Create a transfer in response to a webhook. Transfers are keyed by the
+// caller's event ID (if given) so that redelivered events are only enqueued
+// once. The transfer can optionally be narrowed to specific file names.
+func (i *Itinerary) NewTriggeredTransfer(eventID string, files []string) (*Transfer, error) {
+	transfer, err := NewTransfer(i)
+	if err != nil {
+		return nil, err
+	}
+
+	if eventID != "" {
+		transfer.SetIdempotencyKey(fmt.Sprintf("trigger:%s:%s", i.id, eventID))
+	}
+	if len(files) > 0 {
+		transfer.SetFiles(files)
+	}
+
+	return transfer, nil
+}
+
+// Create a transfer for files that showed up in a watched directory. Only the
+// files that match the itinerary's pattern are included (an error is returned
+// if none of them do) and a new marker stands in for its data file, since that
+// may have shown up (and been skipped) earlier. Transfers are keyed by the
+// files' names, sizes, and mod times so that each version of a file is only
+// enqueued once.
+func (i *Itinerary) NewWatchedTransfer(files []fileserver.FileInfo) (*Transfer, error) {
+	var names []string
+	key := sha256.New()
+	for _, file := range files {
+		name := file.Name
+		if i.marker.IsMarker(name) {
+			name = i.marker.DataFor(name)
+		}
+
+		matched, _ := filepath.Match(i.pattern, name)
+		if !matched {
+			continue
+		}
+
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+		fmt.Fprintf(key, "%s:%d:%d\n", file.Name, file.Size, file.ModTime.UnixNano())
+	}
+
+	if len(names) == 0 {
+		return nil, ErrItineraryNoMatchingFiles
+	}
+
+	transfer, err := NewTransfer(i)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer.SetIdempotencyKey(fmt.Sprintf("watch:%s:%x", i.id, key.Sum(nil)))
+	transfer.SetFiles(names)
+
+	return transfer, nil
+}
+
 func (i *Itinerary) CreatedAt() time.Time {
 	return i.createdAt
 }
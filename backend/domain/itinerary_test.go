@@ -1,9 +1,14 @@
 package domain_test
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
 	"github.com/theandrew168/dripfile/backend/test"
 )
 
@@ -22,6 +27,7 @@ func TestNewItinerary(t *testing.T) {
 	test.AssertEqual(t, itinerary.Pattern(), "*")
 	test.AssertEqual(t, itinerary.FromLocationID(), from.ID())
 	test.AssertEqual(t, itinerary.ToLocationID(), to.ID())
+	test.AssertEqual(t, itinerary.Conflict(), fileserver.ConflictOverwrite)
 }
 
 func TestNewItineraryInvalidPattern(t *testing.T) {
@@ -61,3 +67,341 @@ func TestItineraryCanDelete(t *testing.T) {
 
 	test.AssertNilError(t, itinerary.CheckDelete())
 }
+
+func TestItinerarySetConflict(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	err = itinerary.SetConflict(fileserver.ConflictSkip)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.Conflict(), fileserver.ConflictSkip)
+
+	err = itinerary.SetConflict("clobber")
+	test.AssertErrorIs(t, err, domain.ErrItineraryInvalidConflict)
+	test.AssertEqual(t, itinerary.Conflict(), fileserver.ConflictSkip)
+}
+
+func TestItinerarySetRetry(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.Retry(), fileserver.DefaultRetryPolicy)
+
+	retry := fileserver.RetryPolicy{
+		MaxAttempts:   5,
+		InitialDelay:  time.Minute,
+		BackoffFactor: 3,
+		Jitter:        0.1,
+	}
+
+	err = itinerary.SetRetry(retry)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.Retry(), retry)
+
+	invalid := []fileserver.RetryPolicy{
+		{MaxAttempts: 0, InitialDelay: time.Minute, BackoffFactor: 2},
+		{MaxAttempts: 3, InitialDelay: -time.Minute, BackoffFactor: 2},
+		{MaxAttempts: 3, InitialDelay: time.Minute, BackoffFactor: 0.5},
+		{MaxAttempts: 3, InitialDelay: time.Minute, BackoffFactor: 2, Jitter: 2},
+	}
+	for _, retry := range invalid {
+		err = itinerary.SetRetry(retry)
+		test.AssertErrorIs(t, err, domain.ErrItineraryInvalidRetry)
+	}
+}
+
+func TestItinerarySetMarker(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.Marker(), fileserver.DefaultMarkerPolicy)
+
+	marker := fileserver.MarkerPolicy{
+		Suffix:   ".done",
+		Action:   fileserver.MarkerActionDelete,
+		Complete: "_SUCCESS",
+	}
+
+	err = itinerary.SetMarker(marker)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.Marker(), marker)
+
+	invalid := []fileserver.MarkerPolicy{
+		{Suffix: ".done", Action: "shred"},
+		{Action: fileserver.MarkerActionDelete},
+		{Suffix: "/done", Action: fileserver.MarkerActionKeep},
+		{Action: fileserver.MarkerActionKeep, Complete: "../_SUCCESS"},
+	}
+	for _, marker := range invalid {
+		err = itinerary.SetMarker(marker)
+		test.AssertErrorIs(t, err, domain.ErrItineraryInvalidMarker)
+	}
+}
+
+func TestItinerarySetMaxBytesPerSecond(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.MaxBytesPerSecond(), 0)
+
+	err = itinerary.SetMaxBytesPerSecond(1024)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.MaxBytesPerSecond(), 1024)
+
+	err = itinerary.SetMaxBytesPerSecond(-1)
+	test.AssertErrorIs(t, err, domain.ErrItineraryInvalidBandwidth)
+}
+
+func TestItinerarySetPriority(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.Priority(), 0)
+
+	err = itinerary.SetPriority(10)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.Priority(), 10)
+
+	err = itinerary.SetPriority(domain.MaxPriority + 1)
+	test.AssertErrorIs(t, err, domain.ErrItineraryInvalidPriority)
+}
+
+func TestItinerarySetPollInterval(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.PollInterval(), time.Duration(0))
+	test.AssertEqual(t, itinerary.PollDue(time.Now()), false)
+
+	err = itinerary.SetPollInterval(time.Minute)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.PollInterval(), time.Minute)
+
+	// never polled so due right away
+	test.AssertEqual(t, itinerary.PollDue(time.Now()), true)
+
+	err = itinerary.SetPollInterval(time.Second)
+	test.AssertErrorIs(t, err, domain.ErrItineraryInvalidPoll)
+
+	err = itinerary.SetPollInterval(0)
+	test.AssertNilError(t, err)
+}
+
+func TestItinerarySetTimeouts(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.MaxDuration(), time.Duration(0))
+	test.AssertEqual(t, itinerary.IdleTimeout(), time.Duration(0))
+
+	err = itinerary.SetMaxDuration(time.Hour)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.MaxDuration(), time.Hour)
+
+	err = itinerary.SetIdleTimeout(time.Minute)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.IdleTimeout(), time.Minute)
+
+	err = itinerary.SetMaxDuration(-time.Second)
+	test.AssertErrorIs(t, err, domain.ErrItineraryInvalidTimeout)
+
+	err = itinerary.SetIdleTimeout(-time.Second)
+	test.AssertErrorIs(t, err, domain.ErrItineraryInvalidTimeout)
+}
+
+func TestItineraryTrigger(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.TriggerSecret(), "")
+
+	// triggers are disabled by default
+	test.AssertEqual(t, itinerary.VerifyTriggerToken(""), false)
+
+	secret, err := itinerary.RotateTriggerSecret()
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.TriggerSecret(), secret)
+	test.AssertEqual(t, itinerary.VerifyTriggerToken(secret), true)
+	test.AssertEqual(t, itinerary.VerifyTriggerToken("foobar"), false)
+
+	body := []byte(`{"eventID":"123"}`)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	test.AssertEqual(t, itinerary.VerifyTriggerSignature(body, signature), true)
+	test.AssertEqual(t, itinerary.VerifyTriggerSignature(body, "sha256="+signature), true)
+	test.AssertEqual(t, itinerary.VerifyTriggerSignature([]byte("{}"), signature), false)
+
+	// rotating invalidates the old secret
+	_, err = itinerary.RotateTriggerSecret()
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.VerifyTriggerToken(secret), false)
+
+	err = itinerary.DisableTrigger()
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, itinerary.TriggerSecret(), "")
+}
+
+func TestItineraryNewTriggeredTransfer(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	// the same event always produces the same key
+	first, err := itinerary.NewTriggeredTransfer("123", []string{"a.txt"})
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, first.ItineraryID(), itinerary.ID())
+	test.AssertNotEqual(t, first.IdempotencyKey(), "")
+	test.AssertSliceContains(t, first.Files(), "a.txt")
+
+	second, err := itinerary.NewTriggeredTransfer("123", nil)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, second.IdempotencyKey(), first.IdempotencyKey())
+	test.AssertEqual(t, len(second.Files()), 0)
+
+	// no event means no key
+	third, err := itinerary.NewTriggeredTransfer("", nil)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, third.IdempotencyKey(), "")
+}
+
+func TestItineraryNewWatchedTransfer(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	from, err := domain.NewLocalLocation(root, []string{root})
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*.pdf")
+	test.AssertNilError(t, err)
+
+	files := []fileserver.FileInfo{
+		{Name: "scan.pdf", Size: 1024, ModTime: time.Now()},
+		{Name: "scan.tmp", Size: 512, ModTime: time.Now()},
+	}
+
+	// only matching files are included
+	first, err := itinerary.NewWatchedTransfer(files)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(first.Files()), 1)
+	test.AssertSliceContains(t, first.Files(), "scan.pdf")
+
+	// the same files always produce the same key
+	second, err := itinerary.NewWatchedTransfer(files)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, second.IdempotencyKey(), first.IdempotencyKey())
+
+	// but a new version of a file does not
+	files[0].Size = 2048
+	third, err := itinerary.NewWatchedTransfer(files)
+	test.AssertNilError(t, err)
+	test.AssertNotEqual(t, third.IdempotencyKey(), first.IdempotencyKey())
+
+	_, err = itinerary.NewWatchedTransfer(files[1:])
+	test.AssertErrorIs(t, err, domain.ErrItineraryNoMatchingFiles)
+}
+
+func TestItineraryNewWatchedTransferMarker(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	from, err := domain.NewLocalLocation(root, []string{root})
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*.csv")
+	test.AssertNilError(t, err)
+
+	marker := fileserver.MarkerPolicy{
+		Suffix: ".done",
+		Action: fileserver.MarkerActionKeep,
+	}
+	err = itinerary.SetMarker(marker)
+	test.AssertNilError(t, err)
+
+	// a marker that settles after its data file brings the data file along
+	files := []fileserver.FileInfo{
+		{Name: "report.csv.done", Size: 0, ModTime: time.Now()},
+	}
+	transfer, err := itinerary.NewWatchedTransfer(files)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(transfer.Files()), 1)
+	test.AssertSliceContains(t, transfer.Files(), "report.csv")
+
+	// and it isn't listed twice when both settle together
+	files = append(files, fileserver.FileInfo{Name: "report.csv", Size: 1024, ModTime: time.Now()})
+	transfer, err = itinerary.NewWatchedTransfer(files)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(transfer.Files()), 1)
+	test.AssertSliceContains(t, transfer.Files(), "report.csv")
+}
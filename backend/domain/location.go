@@ -2,6 +2,7 @@ package domain
 
 import (
 	"errors"
+	"path/filepath"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +15,7 @@ type LocationKind string
 const (
 	LocationKindMemory LocationKind = "memory"
 	LocationKindS3     LocationKind = "s3"
+	LocationKindLocal  LocationKind = "local"
 )
 
 type PingStatus string
@@ -25,7 +27,13 @@ const (
 )
 
 var (
-	ErrLocationInvalidKind = errors.New("location: invalid kind")
+	ErrLocationInvalidKind      = errors.New("location: invalid kind")
+	ErrLocationInvalidBandwidth = errors.New("location: invalid bandwidth limit")
+	ErrLocationInvalidMaxActive = errors.New("location: invalid concurrency limit")
+	ErrLocationInvalidMultipart = errors.New("location: invalid multipart settings")
+	ErrLocationInvalidSettle    = errors.New("location: invalid settle time")
+	ErrLocationLocalDisabled    = errors.New("location: local locations are disabled")
+	ErrLocationRootNotAllowed   = errors.New("location: local root is not within an allowed root")
 
 	// TODO: In use by what?
 	ErrLocationInUse = errors.New("location: in use")
@@ -38,8 +46,12 @@ type Location struct {
 	kind       LocationKind
 	memoryInfo fileserver.MemoryInfo
 	s3Info     fileserver.S3Info
+	localInfo  fileserver.LocalInfo
 	pingStatus PingStatus
 
+	maxBytesPerSecond int
+	maxActive         int
+
 	createdAt time.Time
 	updatedAt time.Time
 
@@ -68,6 +80,8 @@ func LoadMemoryLocation(
 	id uuid.UUID,
 	info fileserver.MemoryInfo,
 	pingStatus PingStatus,
+	maxBytesPerSecond int,
+	maxActive int,
 	createdAt time.Time,
 	updatedAt time.Time,
 	usedBy []uuid.UUID,
@@ -79,6 +93,9 @@ func LoadMemoryLocation(
 		memoryInfo: info,
 		pingStatus: pingStatus,
 
+		maxBytesPerSecond: maxBytesPerSecond,
+		maxActive:         maxActive,
+
 		createdAt: createdAt,
 		updatedAt: updatedAt,
 
@@ -127,6 +144,8 @@ func LoadS3Location(
 	id uuid.UUID,
 	info fileserver.S3Info,
 	pingStatus PingStatus,
+	maxBytesPerSecond int,
+	maxActive int,
 	createdAt time.Time,
 	updatedAt time.Time,
 	usedBy []uuid.UUID,
@@ -138,6 +157,100 @@ func LoadS3Location(
 		s3Info:     info,
 		pingStatus: pingStatus,
 
+		maxBytesPerSecond: maxBytesPerSecond,
+		maxActive:         maxActive,
+
+		createdAt: createdAt,
+		updatedAt: updatedAt,
+
+		usedBy: usedBy,
+	}
+	return &l
+}
+
+// Ensure that a local root sits within one of the allowed roots (with any
+// symlinks resolved) and return its resolved path. Local locations are
+// refused entirely if no roots are allowed.
+func CheckLocalRoot(root string, allowedRoots []string) (string, error) {
+	if len(allowedRoots) == 0 {
+		return "", ErrLocationLocalDisabled
+	}
+	if root == "" {
+		return "", errors.New("location: empty local root")
+	}
+	if !filepath.IsAbs(root) {
+		return "", errors.New("location: local root must be absolute")
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(root))
+	if err != nil {
+		return "", errors.New("location: local root must be an existing directory")
+	}
+
+	for _, allowed := range allowedRoots {
+		allowed, err := filepath.EvalSymlinks(filepath.Clean(allowed))
+		if err != nil {
+			continue
+		}
+
+		// the root must be the allowed root itself or somewhere beneath it
+		rel, err := filepath.Rel(allowed, resolved)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+
+		return resolved, nil
+	}
+
+	return "", ErrLocationRootNotAllowed
+}
+
+// Factory func for creating a new local directory location (whose root must
+// sit within one of the allowed roots)
+func NewLocalLocation(root string, allowedRoots []string) (*Location, error) {
+	resolved, err := CheckLocalRoot(root, allowedRoots)
+	if err != nil {
+		return nil, err
+	}
+
+	info := fileserver.LocalInfo{
+		Root: resolved,
+	}
+
+	l := Location{
+		id: uuid.New(),
+
+		kind:       LocationKindLocal,
+		localInfo:  info,
+		pingStatus: PingStatusUnknown,
+
+		createdAt: time.Now(),
+		updatedAt: time.Now(),
+	}
+	return &l, nil
+}
+
+// Create a local directory location from existing data
+func LoadLocalLocation(
+	id uuid.UUID,
+	info fileserver.LocalInfo,
+	pingStatus PingStatus,
+	maxBytesPerSecond int,
+	maxActive int,
+	createdAt time.Time,
+	updatedAt time.Time,
+	usedBy []uuid.UUID,
+) *Location {
+	l := Location{
+		id: id,
+
+		kind:       LocationKindLocal,
+		localInfo:  info,
+		pingStatus: pingStatus,
+
+		maxBytesPerSecond: maxBytesPerSecond,
+		maxActive:         maxActive,
+
 		createdAt: createdAt,
 		updatedAt: updatedAt,
 
@@ -159,6 +272,8 @@ func (l *Location) Info() any {
 		return l.memoryInfo
 	} else if l.kind == LocationKindS3 {
 		return l.s3Info
+	} else if l.kind == LocationKindLocal {
+		return l.localInfo
 	}
 
 	return nil
@@ -173,6 +288,69 @@ func (l *Location) SetPingStatus(pingStatus PingStatus) error {
 	return nil
 }
 
+// Maximum throughput (in bytes per second) when reading from or writing to this
+// location across all of a worker process's transfers (zero means unlimited).
+// Each worker process enforces this separately.
+func (l *Location) MaxBytesPerSecond() int {
+	return l.maxBytesPerSecond
+}
+
+func (l *Location) SetMaxBytesPerSecond(maxBytesPerSecond int) error {
+	if maxBytesPerSecond < 0 {
+		return ErrLocationInvalidBandwidth
+	}
+
+	l.maxBytesPerSecond = maxBytesPerSecond
+	return nil
+}
+
+// Maximum number of transfers that may read from or write to this location at
+// once, across all workers (zero means unlimited).
+func (l *Location) MaxActive() int {
+	return l.maxActive
+}
+
+func (l *Location) SetMaxActive(maxActive int) error {
+	if maxActive < 0 {
+		return ErrLocationInvalidMaxActive
+	}
+
+	l.maxActive = maxActive
+	return nil
+}
+
+// Tune how large files are streamed to an S3 location: the size of each part
+// and how many parts are uploaded in parallel (zero uses the defaults).
+func (l *Location) SetS3Multipart(partSize, concurrency int) error {
+	if l.kind != LocationKindS3 {
+		return ErrLocationInvalidKind
+	}
+	if partSize != 0 && (partSize < fileserver.S3MinPartSize || partSize > fileserver.S3MaxPartSize) {
+		return ErrLocationInvalidMultipart
+	}
+	if concurrency < 0 {
+		return ErrLocationInvalidMultipart
+	}
+
+	l.s3Info.PartSize = partSize
+	l.s3Info.Concurrency = concurrency
+	return nil
+}
+
+// How long new files in a local directory must go unchanged before they are
+// transferred (zero uses the default).
+func (l *Location) SetLocalSettleTime(settleTime time.Duration) error {
+	if l.kind != LocationKindLocal {
+		return ErrLocationInvalidKind
+	}
+	if settleTime < 0 {
+		return ErrLocationInvalidSettle
+	}
+
+	l.localInfo.SettleTime = settleTime
+	return nil
+}
+
 func (l *Location) CreatedAt() time.Time {
 	return l.createdAt
 }
@@ -204,11 +382,22 @@ func (l *Location) Connect() (fileserver.FileServer, error) {
 		return fileserver.NewMemory(l.memoryInfo)
 	case LocationKindS3:
 		return fileserver.NewS3(l.s3Info)
+	case LocationKindLocal:
+		return fileserver.NewLocal(l.localInfo)
 	default:
 		return nil, ErrLocationInvalidKind
 	}
 }
 
+// Watch a local directory location for new files.
+func (l *Location) Watch() (*fileserver.LocalWatcher, error) {
+	if l.kind != LocationKindLocal {
+		return nil, ErrLocationInvalidKind
+	}
+
+	return fileserver.NewLocalWatcher(l.localInfo)
+}
+
 func (l *Location) useBy(itinerary *Itinerary) {
 	l.usedBy = append(l.usedBy, itinerary.ID())
 }
@@ -1,9 +1,13 @@
 package domain_test
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
 	"github.com/theandrew168/dripfile/backend/test"
 )
 
@@ -33,3 +37,149 @@ func TestLocationCheckDelete(t *testing.T) {
 	test.AssertErrorIs(t, from.CheckDelete(), domain.ErrLocationInUse)
 	test.AssertErrorIs(t, to.CheckDelete(), domain.ErrLocationInUse)
 }
+
+func TestLocationSetMaxBytesPerSecond(t *testing.T) {
+	t.Parallel()
+
+	location, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, location.MaxBytesPerSecond(), 0)
+
+	err = location.SetMaxBytesPerSecond(1024)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, location.MaxBytesPerSecond(), 1024)
+
+	err = location.SetMaxBytesPerSecond(-1)
+	test.AssertErrorIs(t, err, domain.ErrLocationInvalidBandwidth)
+}
+
+func TestLocationSetMaxActive(t *testing.T) {
+	t.Parallel()
+
+	location, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, location.MaxActive(), 0)
+
+	err = location.SetMaxActive(2)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, location.MaxActive(), 2)
+
+	err = location.SetMaxActive(-1)
+	test.AssertErrorIs(t, err, domain.ErrLocationInvalidMaxActive)
+}
+
+func TestLocationSetS3Multipart(t *testing.T) {
+	t.Parallel()
+
+	location, err := domain.NewS3Location("localhost:9000", "bucket", "key", "secret")
+	test.AssertNilError(t, err)
+
+	err = location.SetS3Multipart(32*1024*1024, 4)
+	test.AssertNilError(t, err)
+
+	info := location.Info().(fileserver.S3Info)
+	test.AssertEqual(t, info.PartSize, 32*1024*1024)
+	test.AssertEqual(t, info.Concurrency, 4)
+
+	err = location.SetS3Multipart(1024, 4)
+	test.AssertErrorIs(t, err, domain.ErrLocationInvalidMultipart)
+
+	err = location.SetS3Multipart(fileserver.S3MaxPartSize+1, 4)
+	test.AssertErrorIs(t, err, domain.ErrLocationInvalidMultipart)
+
+	err = location.SetS3Multipart(0, -1)
+	test.AssertErrorIs(t, err, domain.ErrLocationInvalidMultipart)
+
+	memory, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = memory.SetS3Multipart(0, 0)
+	test.AssertErrorIs(t, err, domain.ErrLocationInvalidKind)
+}
+
+func TestNewLocalLocation(t *testing.T) {
+	t.Parallel()
+
+	allowed := t.TempDir()
+	inbox := filepath.Join(allowed, "inbox")
+	err := os.Mkdir(inbox, 0755)
+	test.AssertNilError(t, err)
+
+	location, err := domain.NewLocalLocation(inbox, []string{allowed})
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, location.Kind(), domain.LocationKindLocal)
+
+	_, err = location.Watch()
+	test.AssertNilError(t, err)
+
+	_, err = domain.NewLocalLocation("inbox", []string{allowed})
+	test.AssertNotEqual(t, err, nil)
+
+	memory, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	_, err = memory.Watch()
+	test.AssertErrorIs(t, err, domain.ErrLocationInvalidKind)
+}
+
+func TestNewLocalLocationAllowedRoots(t *testing.T) {
+	t.Parallel()
+
+	allowed := t.TempDir()
+	other := t.TempDir()
+
+	// a link inside the allowed root that points outside of it
+	escape := filepath.Join(allowed, "escape")
+	err := os.Symlink(other, escape)
+	test.AssertNilError(t, err)
+
+	tests := []struct {
+		name    string
+		root    string
+		allowed []string
+		err     error
+	}{
+		{"allowed root", allowed, []string{allowed}, nil},
+		{"outside", other, []string{allowed}, domain.ErrLocationRootNotAllowed},
+		{"filesystem root", "/", []string{allowed}, domain.ErrLocationRootNotAllowed},
+		{"dot dot", filepath.Join(allowed, "..", filepath.Base(other)), []string{allowed}, domain.ErrLocationRootNotAllowed},
+		{"symlink", escape, []string{allowed}, domain.ErrLocationRootNotAllowed},
+		{"disabled", allowed, nil, domain.ErrLocationLocalDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := domain.NewLocalLocation(tt.root, tt.allowed)
+			if tt.err == nil {
+				test.AssertNilError(t, err)
+			} else {
+				test.AssertErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLocationSetLocalSettleTime(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	location, err := domain.NewLocalLocation(root, []string{root})
+	test.AssertNilError(t, err)
+
+	err = location.SetLocalSettleTime(5 * time.Second)
+	test.AssertNilError(t, err)
+
+	info := location.Info().(fileserver.LocalInfo)
+	test.AssertEqual(t, info.SettleTime, 5*time.Second)
+
+	err = location.SetLocalSettleTime(-time.Second)
+	test.AssertErrorIs(t, err, domain.ErrLocationInvalidSettle)
+
+	memory, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = memory.SetLocalSettleTime(time.Second)
+	test.AssertErrorIs(t, err, domain.ErrLocationInvalidKind)
+}
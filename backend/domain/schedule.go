@@ -0,0 +1,207 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrScheduleInvalidExpr     = errors.New("schedule: invalid cron expression")
+	ErrScheduleInvalidTimezone = errors.New("schedule: invalid time zone")
+	ErrScheduleAlreadyLinked   = errors.New("schedule: itinerary already linked")
+	ErrScheduleNotLinked       = errors.New("schedule: itinerary not linked")
+)
+
+// Standard five-field cron expressions (minute, hour, day of month, month,
+// day of week) plus descriptors such as @daily and @hourly.
+var cronParser = cron.NewParser(
+	cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// Aggregate with a single entity
+type Schedule struct {
+	id uuid.UUID
+
+	expr      string
+	timezone  string
+	nextRunAt time.Time
+
+	itineraryIDs []uuid.UUID
+
+	createdAt time.Time
+	updatedAt time.Time
+
+	// derived from expr and timezone
+	cron     cron.Schedule
+	location *time.Location
+}
+
+// Factory func for creating a new schedule
+func NewSchedule(expr, timezone string) (*Schedule, error) {
+	s := Schedule{
+		id: uuid.New(),
+
+		expr:     expr,
+		timezone: timezone,
+
+		itineraryIDs: []uuid.UUID{},
+
+		createdAt: time.Now(),
+		updatedAt: time.Now(),
+	}
+
+	err := s.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	s.nextRunAt = s.Next(time.Now())
+	return &s, nil
+}
+
+// Create a schedule from existing data
+func LoadSchedule(
+	id uuid.UUID,
+	expr string,
+	timezone string,
+	nextRunAt time.Time,
+	itineraryIDs []uuid.UUID,
+	createdAt time.Time,
+	updatedAt time.Time,
+) *Schedule {
+	s := Schedule{
+		id: id,
+
+		expr:      expr,
+		timezone:  timezone,
+		nextRunAt: nextRunAt,
+
+		itineraryIDs: itineraryIDs,
+
+		createdAt: createdAt,
+		updatedAt: updatedAt,
+	}
+
+	// stored expressions were validated upon creation
+	s.parse()
+
+	return &s
+}
+
+func (s *Schedule) parse() error {
+	location, err := time.LoadLocation(s.timezone)
+	if err != nil {
+		return ErrScheduleInvalidTimezone
+	}
+
+	schedule, err := cronParser.Parse(s.expr)
+	if err != nil {
+		return ErrScheduleInvalidExpr
+	}
+
+	s.cron = schedule
+	s.location = location
+	return nil
+}
+
+func (s *Schedule) ID() uuid.UUID {
+	return s.id
+}
+
+func (s *Schedule) Expr() string {
+	return s.expr
+}
+
+func (s *Schedule) Timezone() string {
+	return s.timezone
+}
+
+// The next tick at which linked itineraries should be transferred.
+func (s *Schedule) NextRunAt() time.Time {
+	return s.nextRunAt
+}
+
+// Calculate the first tick strictly after a given time (evaluated in the
+// schedule's time zone).
+func (s *Schedule) Next(after time.Time) time.Time {
+	if s.cron == nil {
+		return time.Time{}
+	}
+
+	return s.cron.Next(after.In(s.location))
+}
+
+// Whether or not the schedule has a tick that is due as of a given time.
+func (s *Schedule) Due(now time.Time) bool {
+	return !s.nextRunAt.IsZero() && !s.nextRunAt.After(now)
+}
+
+// Move the schedule past the current tick (skipping any that were missed).
+func (s *Schedule) Advance(now time.Time) error {
+	s.nextRunAt = s.Next(now)
+	return nil
+}
+
+// Create the transfer of a linked itinerary for a given tick. Transfers are
+// keyed by schedule, itinerary, and tick so that each tick is only enqueued
+// once no matter how many schedulers race to do it.
+func (s *Schedule) NewTransfer(itinerary *Itinerary, tick time.Time) (*Transfer, error) {
+	if !slices.Contains(s.itineraryIDs, itinerary.ID()) {
+		return nil, ErrScheduleNotLinked
+	}
+
+	transfer, err := NewTransfer(itinerary)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("schedule:%s:%s:%d", s.id, itinerary.ID(), tick.Unix())
+	transfer.SetIdempotencyKey(key)
+
+	return transfer, nil
+}
+
+func (s *Schedule) ItineraryIDs() []uuid.UUID {
+	return s.itineraryIDs
+}
+
+func (s *Schedule) Link(itinerary *Itinerary) error {
+	if slices.Contains(s.itineraryIDs, itinerary.ID()) {
+		return ErrScheduleAlreadyLinked
+	}
+
+	s.itineraryIDs = append(s.itineraryIDs, itinerary.ID())
+	return nil
+}
+
+func (s *Schedule) Unlink(itinerary *Itinerary) error {
+	index := slices.Index(s.itineraryIDs, itinerary.ID())
+	if index < 0 {
+		return ErrScheduleNotLinked
+	}
+
+	s.itineraryIDs = slices.Delete(s.itineraryIDs, index, index+1)
+	return nil
+}
+
+func (s *Schedule) CreatedAt() time.Time {
+	return s.createdAt
+}
+
+func (s *Schedule) UpdatedAt() time.Time {
+	return s.updatedAt
+}
+
+func (s *Schedule) SetUpdatedAt(updatedAt time.Time) error {
+	s.updatedAt = updatedAt
+	return nil
+}
+
+func (s *Schedule) CheckDelete() error {
+	return nil
+}
@@ -0,0 +1,130 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestNewSchedule(t *testing.T) {
+	t.Parallel()
+
+	schedule, err := domain.NewSchedule("0 9 * * *", "America/Chicago")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, schedule.Expr(), "0 9 * * *")
+	test.AssertEqual(t, schedule.Timezone(), "America/Chicago")
+	test.AssertEqual(t, schedule.NextRunAt().After(time.Now()), true)
+	test.AssertEqual(t, len(schedule.ItineraryIDs()), 0)
+}
+
+func TestNewScheduleInvalidExpr(t *testing.T) {
+	t.Parallel()
+
+	_, err := domain.NewSchedule("every tuesday", "UTC")
+	test.AssertErrorIs(t, err, domain.ErrScheduleInvalidExpr)
+}
+
+func TestNewScheduleInvalidTimezone(t *testing.T) {
+	t.Parallel()
+
+	_, err := domain.NewSchedule("@daily", "Mars/Olympus_Mons")
+	test.AssertErrorIs(t, err, domain.ErrScheduleInvalidTimezone)
+}
+
+func TestScheduleNext(t *testing.T) {
+	t.Parallel()
+
+	schedule, err := domain.NewSchedule("0 9 * * *", "America/Chicago")
+	test.AssertNilError(t, err)
+
+	// 9am in Chicago (CDT) is 14:00 UTC
+	after := time.Date(2024, time.July, 1, 12, 0, 0, 0, time.UTC)
+	next := schedule.Next(after)
+	test.AssertEqual(t, next.UTC(), time.Date(2024, time.July, 1, 14, 0, 0, 0, time.UTC))
+}
+
+func TestScheduleAdvance(t *testing.T) {
+	t.Parallel()
+
+	schedule, err := domain.NewSchedule("@hourly", "UTC")
+	test.AssertNilError(t, err)
+
+	tick := schedule.NextRunAt()
+	test.AssertEqual(t, schedule.Due(tick.Add(-time.Second)), false)
+	test.AssertEqual(t, schedule.Due(tick), true)
+
+	// missed ticks are skipped
+	now := tick.Add(3*time.Hour + time.Minute)
+	err = schedule.Advance(now)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, schedule.NextRunAt(), tick.Add(4*time.Hour))
+	test.AssertEqual(t, schedule.Due(now), false)
+}
+
+func TestScheduleLink(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	schedule, err := domain.NewSchedule("@daily", "UTC")
+	test.AssertNilError(t, err)
+
+	err = schedule.Link(itinerary)
+	test.AssertNilError(t, err)
+	test.AssertSliceContains(t, schedule.ItineraryIDs(), itinerary.ID())
+
+	err = schedule.Link(itinerary)
+	test.AssertErrorIs(t, err, domain.ErrScheduleAlreadyLinked)
+
+	err = schedule.Unlink(itinerary)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(schedule.ItineraryIDs()), 0)
+
+	err = schedule.Unlink(itinerary)
+	test.AssertErrorIs(t, err, domain.ErrScheduleNotLinked)
+}
+
+func TestScheduleNewTransfer(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	schedule, err := domain.NewSchedule("@daily", "UTC")
+	test.AssertNilError(t, err)
+
+	_, err = schedule.NewTransfer(itinerary, schedule.NextRunAt())
+	test.AssertErrorIs(t, err, domain.ErrScheduleNotLinked)
+
+	err = schedule.Link(itinerary)
+	test.AssertNilError(t, err)
+
+	// the same tick always produces the same key
+	first, err := schedule.NewTransfer(itinerary, schedule.NextRunAt())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, first.ItineraryID(), itinerary.ID())
+	test.AssertNotEqual(t, first.IdempotencyKey(), "")
+
+	second, err := schedule.NewTransfer(itinerary, schedule.NextRunAt())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, second.IdempotencyKey(), first.IdempotencyKey())
+
+	third, err := schedule.NewTransfer(itinerary, schedule.Next(schedule.NextRunAt()))
+	test.AssertNilError(t, err)
+	test.AssertNotEqual(t, third.IdempotencyKey(), first.IdempotencyKey())
+}
@@ -1,27 +1,66 @@
 package domain
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/fileserver"
 )
 
 type TransferStatus string
 
 const (
-	TransferStatusPending TransferStatus = "pending"
-	TransferStatusRunning TransferStatus = "running"
-	TransferStatusSuccess TransferStatus = "success"
-	TransferStatusFailure TransferStatus = "failure"
+	TransferStatusPending  TransferStatus = "pending"
+	TransferStatusRunning  TransferStatus = "running"
+	TransferStatusRetrying TransferStatus = "retrying"
+	TransferStatusSuccess  TransferStatus = "success"
+	TransferStatusFailure  TransferStatus = "failure"
+	TransferStatusCanceled TransferStatus = "canceled"
+	TransferStatusTimeout  TransferStatus = "timeout"
+)
+
+// Range of transfer priorities: higher priority transfers are started first
+// (and transfers of the same priority are started oldest first).
+const (
+	MinPriority = -100
+	MaxPriority = 100
+)
+
+var (
+	ErrTransferInvalidPriority = errors.New("transfer: invalid priority")
+	ErrTransferCanceled        = errors.New("transfer: canceled")
+	ErrTransferTimeout         = errors.New("transfer: exceeded max duration")
+	ErrTransferFinished        = errors.New("transfer: already finished")
+	ErrTransferNotFinished     = errors.New("transfer: not finished")
+	ErrTransferNotFailed       = errors.New("transfer: not failed")
+	ErrTransferNoFailures      = errors.New("transfer: no failed files")
 )
 
 type Transfer struct {
 	id uuid.UUID
 
 	itineraryID uuid.UUID
+	parentID    uuid.UUID
 	status      TransferStatus
 	progress    int
 	error       string
+	results     []fileserver.TransferResult
+	partial     *fileserver.Partial
+
+	priority  int
+	notBefore time.Time
+
+	attempts      int
+	nextAttemptAt time.Time
+
+	idempotencyKey string
+	files          []string
+
+	cancelRequestedAt time.Time
+
+	stuckOn string
 
 	createdAt time.Time
 	updatedAt time.Time
@@ -35,6 +74,9 @@ func NewTransfer(itinerary *Itinerary) (*Transfer, error) {
 		status:      TransferStatusPending,
 		progress:    0,
 		error:       "",
+		results:     []fileserver.TransferResult{},
+
+		priority: itinerary.Priority(),
 
 		createdAt: time.Now(),
 		updatedAt: time.Now(),
@@ -46,9 +88,20 @@ func NewTransfer(itinerary *Itinerary) (*Transfer, error) {
 func LoadTransfer(
 	id uuid.UUID,
 	itineraryID uuid.UUID,
+	parentID uuid.UUID,
 	status TransferStatus,
 	progress int,
 	error string,
+	results []fileserver.TransferResult,
+	partial *fileserver.Partial,
+	priority int,
+	notBefore time.Time,
+	attempts int,
+	nextAttemptAt time.Time,
+	idempotencyKey string,
+	files []string,
+	cancelRequestedAt time.Time,
+	stuckOn string,
 	createdAt time.Time,
 	updatedAt time.Time,
 ) *Transfer {
@@ -56,9 +109,25 @@ func LoadTransfer(
 		id: id,
 
 		itineraryID: itineraryID,
+		parentID:    parentID,
 		status:      status,
 		progress:    progress,
 		error:       error,
+		results:     results,
+		partial:     partial,
+
+		priority:  priority,
+		notBefore: notBefore,
+
+		attempts:      attempts,
+		nextAttemptAt: nextAttemptAt,
+
+		idempotencyKey: idempotencyKey,
+		files:          files,
+
+		cancelRequestedAt: cancelRequestedAt,
+
+		stuckOn: stuckOn,
 
 		createdAt: createdAt,
 		updatedAt: updatedAt,
@@ -74,6 +143,11 @@ func (t *Transfer) ItineraryID() uuid.UUID {
 	return t.itineraryID
 }
 
+// Transfer that this one reran or retried (uuid.Nil if it is an original)
+func (t *Transfer) ParentID() uuid.UUID {
+	return t.parentID
+}
+
 func (t *Transfer) Status() TransferStatus {
 	return t.status
 }
@@ -101,6 +175,200 @@ func (t *Transfer) SetError(error string) error {
 	return nil
 }
 
+// Per-file outcomes (including the action chosen for any destination conflicts)
+func (t *Transfer) Results() []fileserver.TransferResult {
+	return t.results
+}
+
+func (t *Transfer) AddResult(result fileserver.TransferResult) error {
+	t.results = append(t.results, result)
+	return nil
+}
+
+// Names of source files that have already been handled
+func (t *Transfer) Completed() map[string]bool {
+	completed := make(map[string]bool)
+	for _, result := range t.results {
+		completed[result.Name] = true
+	}
+
+	return completed
+}
+
+// Checkpoint for a file that was only partially copied (if any)
+func (t *Transfer) Partial() *fileserver.Partial {
+	return t.partial
+}
+
+func (t *Transfer) SetPartial(partial *fileserver.Partial) error {
+	t.partial = partial
+	return nil
+}
+
+// Transfers with a higher priority are started first (even ahead of older ones)
+func (t *Transfer) Priority() int {
+	return t.priority
+}
+
+func (t *Transfer) SetPriority(priority int) error {
+	if priority < MinPriority || priority > MaxPriority {
+		return ErrTransferInvalidPriority
+	}
+
+	t.priority = priority
+	return nil
+}
+
+// Earliest time that the transfer may start (zero means right away).
+func (t *Transfer) NotBefore() time.Time {
+	return t.notBefore
+}
+
+func (t *Transfer) SetNotBefore(notBefore time.Time) error {
+	t.notBefore = notBefore
+	return nil
+}
+
+// Number of times this transfer has been picked up by a worker
+func (t *Transfer) Attempts() int {
+	return t.attempts
+}
+
+// When a retrying transfer becomes eligible to run again
+func (t *Transfer) NextAttemptAt() time.Time {
+	return t.nextAttemptAt
+}
+
+// Put a failed transfer back into the queue to be tried again later
+func (t *Transfer) ScheduleRetry(nextAttemptAt time.Time) error {
+	t.status = TransferStatusRetrying
+	t.nextAttemptAt = nextAttemptAt
+	return nil
+}
+
+// Unique key that prevents the same transfer from being enqueued twice
+// (empty for transfers that aren't deduplicated)
+func (t *Transfer) IdempotencyKey() string {
+	return t.idempotencyKey
+}
+
+func (t *Transfer) SetIdempotencyKey(idempotencyKey string) error {
+	t.idempotencyKey = idempotencyKey
+	return nil
+}
+
+// Source file names that this transfer is restricted to (nil means every
+// file matching the itinerary's pattern)
+func (t *Transfer) Files() []string {
+	return t.files
+}
+
+func (t *Transfer) SetFiles(files []string) error {
+	t.files = files
+	return nil
+}
+
+// Check whether this transfer has stopped for good (successfully or not).
+func (t *Transfer) Finished() bool {
+	switch t.status {
+	case TransferStatusSuccess, TransferStatusFailure, TransferStatusCanceled, TransferStatusTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Ask for this transfer to be canceled. Transfers that haven't started yet
+// are canceled immediately while running ones are stopped by their worker.
+func (t *Transfer) Cancel() error {
+	if t.Finished() {
+		return ErrTransferFinished
+	}
+
+	if t.status != TransferStatusRunning {
+		t.status = TransferStatusCanceled
+	}
+
+	t.cancelRequestedAt = time.Now()
+	return nil
+}
+
+// When cancellation was requested (zero if it hasn't been)
+func (t *Transfer) CancelRequestedAt() time.Time {
+	return t.cancelRequestedAt
+}
+
+func (t *Transfer) CancelRequested() bool {
+	return !t.cancelRequestedAt.IsZero()
+}
+
+// Give up on a transfer that ran for too long (or stopped making progress),
+// noting the source file that it was stuck on (if any).
+func (t *Transfer) TimeOut(stuckOn string, reason error) error {
+	if t.Finished() {
+		return ErrTransferFinished
+	}
+
+	t.status = TransferStatusTimeout
+	t.error = reason.Error()
+	t.stuckOn = stuckOn
+	return nil
+}
+
+// Source file that the transfer was copying when it timed out (if any)
+func (t *Transfer) StuckOn() string {
+	return t.stuckOn
+}
+
+// Create a new transfer that repeats this (finished) one.
+func (t *Transfer) Rerun(itinerary *Itinerary) (*Transfer, error) {
+	if !t.Finished() {
+		return nil, ErrTransferNotFinished
+	}
+
+	rerun, err := NewTransfer(itinerary)
+	if err != nil {
+		return nil, err
+	}
+
+	rerun.parentID = t.id
+	rerun.files = t.files
+	return rerun, nil
+}
+
+// Create a new transfer that only copies the files this (failed, canceled, or
+// timed out) one didn't get to. Candidates are the files that it set out to
+// transfer (or, if it copied whatever matched, the source's current matches).
+func (t *Transfer) RetryFailed(itinerary *Itinerary, candidates []string) (*Transfer, error) {
+	switch t.status {
+	case TransferStatusFailure, TransferStatusCanceled, TransferStatusTimeout:
+	default:
+		return nil, ErrTransferNotFailed
+	}
+
+	completed := t.Completed()
+
+	var failed []string
+	for _, name := range candidates {
+		if !completed[name] {
+			failed = append(failed, name)
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil, ErrTransferNoFailures
+	}
+
+	retry, err := NewTransfer(itinerary)
+	if err != nil {
+		return nil, err
+	}
+
+	retry.parentID = t.id
+	retry.files = failed
+	return retry, nil
+}
+
 func (t *Transfer) CreatedAt() time.Time {
 	return t.createdAt
 }
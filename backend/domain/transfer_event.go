@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TransferEventKind string
+
+const (
+	TransferEventQueued        TransferEventKind = "queued"
+	TransferEventAcquired      TransferEventKind = "acquired"
+	TransferEventStarted       TransferEventKind = "started"
+	TransferEventFileStarted   TransferEventKind = "file_started"
+	TransferEventFileCompleted TransferEventKind = "file_completed"
+	TransferEventFileFailed    TransferEventKind = "file_failed"
+	TransferEventRetried       TransferEventKind = "retried"
+	TransferEventCanceled      TransferEventKind = "canceled"
+	TransferEventFinished      TransferEventKind = "finished"
+)
+
+// Something that happened to a transfer (events are never changed once saved)
+type TransferEvent struct {
+	id uuid.UUID
+
+	transferID uuid.UUID
+	kind       TransferEventKind
+	workerID   string
+	file       string
+	message    string
+
+	createdAt time.Time
+}
+
+// Factory func for creating a new transfer event
+func NewTransferEvent(transfer *Transfer, kind TransferEventKind, message string) (*TransferEvent, error) {
+	event := TransferEvent{
+		id: uuid.New(),
+
+		transferID: transfer.ID(),
+		kind:       kind,
+		message:    message,
+
+		createdAt: time.Now(),
+	}
+	return &event, nil
+}
+
+// Create a transfer event from existing data
+func LoadTransferEvent(
+	id uuid.UUID,
+	transferID uuid.UUID,
+	kind TransferEventKind,
+	workerID string,
+	file string,
+	message string,
+	createdAt time.Time,
+) *TransferEvent {
+	e := TransferEvent{
+		id: id,
+
+		transferID: transferID,
+		kind:       kind,
+		workerID:   workerID,
+		file:       file,
+		message:    message,
+
+		createdAt: createdAt,
+	}
+	return &e
+}
+
+func (e *TransferEvent) ID() uuid.UUID {
+	return e.id
+}
+
+func (e *TransferEvent) TransferID() uuid.UUID {
+	return e.transferID
+}
+
+func (e *TransferEvent) Kind() TransferEventKind {
+	return e.kind
+}
+
+// Worker (host and process) that the event happened on (if any)
+func (e *TransferEvent) WorkerID() string {
+	return e.workerID
+}
+
+func (e *TransferEvent) SetWorkerID(workerID string) error {
+	e.workerID = workerID
+	return nil
+}
+
+// Source file that the event is about (if any)
+func (e *TransferEvent) File() string {
+	return e.file
+}
+
+func (e *TransferEvent) SetFile(file string) error {
+	e.file = file
+	return nil
+}
+
+func (e *TransferEvent) Message() string {
+	return e.message
+}
+
+func (e *TransferEvent) CreatedAt() time.Time {
+	return e.createdAt
+}
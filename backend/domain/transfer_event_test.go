@@ -0,0 +1,37 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestNewTransferEvent(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	event, err := domain.NewTransferEvent(transfer, domain.TransferEventFileFailed, "broken pipe")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, event.TransferID(), transfer.ID())
+	test.AssertEqual(t, event.Kind(), domain.TransferEventFileFailed)
+	test.AssertEqual(t, event.Message(), "broken pipe")
+	test.AssertEqual(t, event.WorkerID(), "")
+	test.AssertEqual(t, event.File(), "")
+
+	event.SetWorkerID("host:123")
+	event.SetFile("foo.txt")
+	test.AssertEqual(t, event.WorkerID(), "host:123")
+	test.AssertEqual(t, event.File(), "foo.txt")
+}
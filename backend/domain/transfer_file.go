@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/fileserver"
+)
+
+type TransferFileStatus string
+
+const (
+	TransferFileStatusSuccess TransferFileStatus = "success"
+	TransferFileStatusSkipped TransferFileStatus = "skipped"
+	TransferFileStatusFailure TransferFileStatus = "failure"
+)
+
+// Record of what happened to a single file during a transfer
+type TransferFile struct {
+	id uuid.UUID
+
+	transferID uuid.UUID
+	name       string
+	dest       string
+	size       int
+	checksum   string
+	status     TransferFileStatus
+	error      string
+	attempts   int
+
+	startedAt  time.Time
+	finishedAt time.Time
+
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// Factory func for recording a file's outcome (a nil err means it was handled)
+func NewTransferFile(transfer *Transfer, result fileserver.TransferResult, err error) (*TransferFile, error) {
+	status := TransferFileStatusSuccess
+	if result.Action == fileserver.ActionSkip {
+		status = TransferFileStatusSkipped
+	}
+
+	var message string
+	if err != nil {
+		status = TransferFileStatusFailure
+		message = err.Error()
+	}
+
+	file := TransferFile{
+		id: uuid.New(),
+
+		transferID: transfer.ID(),
+		name:       result.Name,
+		dest:       result.Dest,
+		size:       result.Size,
+		checksum:   result.Checksum,
+		status:     status,
+		error:      message,
+		attempts:   result.Attempts,
+
+		startedAt:  result.StartedAt,
+		finishedAt: result.FinishedAt,
+
+		createdAt: time.Now(),
+		updatedAt: time.Now(),
+	}
+	return &file, nil
+}
+
+// Create a transfer file from existing data
+func LoadTransferFile(
+	id uuid.UUID,
+	transferID uuid.UUID,
+	name string,
+	dest string,
+	size int,
+	checksum string,
+	status TransferFileStatus,
+	error string,
+	attempts int,
+	startedAt time.Time,
+	finishedAt time.Time,
+	createdAt time.Time,
+	updatedAt time.Time,
+) *TransferFile {
+	f := TransferFile{
+		id: id,
+
+		transferID: transferID,
+		name:       name,
+		dest:       dest,
+		size:       size,
+		checksum:   checksum,
+		status:     status,
+		error:      error,
+		attempts:   attempts,
+
+		startedAt:  startedAt,
+		finishedAt: finishedAt,
+
+		createdAt: createdAt,
+		updatedAt: updatedAt,
+	}
+	return &f
+}
+
+func (f *TransferFile) ID() uuid.UUID {
+	return f.id
+}
+
+func (f *TransferFile) TransferID() uuid.UUID {
+	return f.transferID
+}
+
+// Name of the file at the source location
+func (f *TransferFile) Name() string {
+	return f.name
+}
+
+// Name of the file at the destination location
+func (f *TransferFile) Dest() string {
+	return f.dest
+}
+
+func (f *TransferFile) Size() int {
+	return f.size
+}
+
+// Hex-encoded SHA-256 of the copied file (empty if unknown)
+func (f *TransferFile) Checksum() string {
+	return f.checksum
+}
+
+func (f *TransferFile) Status() TransferFileStatus {
+	return f.status
+}
+
+func (f *TransferFile) Error() string {
+	return f.error
+}
+
+func (f *TransferFile) Attempts() int {
+	return f.attempts
+}
+
+func (f *TransferFile) StartedAt() time.Time {
+	return f.startedAt
+}
+
+func (f *TransferFile) FinishedAt() time.Time {
+	return f.finishedAt
+}
+
+func (f *TransferFile) CreatedAt() time.Time {
+	return f.createdAt
+}
+
+func (f *TransferFile) UpdatedAt() time.Time {
+	return f.updatedAt
+}
@@ -0,0 +1,60 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestNewTransferFile(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	tests := []struct {
+		name   string
+		action fileserver.Action
+		err    error
+		status domain.TransferFileStatus
+	}{
+		{"copied", fileserver.ActionCopy, nil, domain.TransferFileStatusSuccess},
+		{"skipped", fileserver.ActionSkip, nil, domain.TransferFileStatusSkipped},
+		{"failed", fileserver.ActionCopy, errors.New("broken pipe"), domain.TransferFileStatusFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			result := fileserver.TransferResult{
+				Name:     "a.txt",
+				Dest:     "b.txt",
+				Size:     100,
+				Action:   tt.action,
+				Attempts: 2,
+			}
+
+			file, err := domain.NewTransferFile(transfer, result, tt.err)
+			test.AssertNilError(t, err)
+			test.AssertEqual(t, file.TransferID(), transfer.ID())
+			test.AssertEqual(t, file.Name(), "a.txt")
+			test.AssertEqual(t, file.Dest(), "b.txt")
+			test.AssertEqual(t, file.Attempts(), 2)
+			test.AssertEqual(t, file.Status(), tt.status)
+			test.AssertEqual(t, file.Error() != "", tt.err != nil)
+		})
+	}
+}
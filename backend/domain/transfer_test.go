@@ -2,8 +2,10 @@ package domain_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
 	"github.com/theandrew168/dripfile/backend/test"
 )
 
@@ -84,3 +86,253 @@ func TestTransferUpdateProgress(t *testing.T) {
 
 	test.AssertEqual(t, transfer.Progress(), 100)
 }
+
+func TestTransferAddResult(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(transfer.Results()), 0)
+
+	result := fileserver.TransferResult{
+		Name:   "foo.txt",
+		Dest:   "foo-1.txt",
+		Size:   42,
+		Action: fileserver.ActionRename,
+	}
+
+	err = transfer.AddResult(result)
+	test.AssertNilError(t, err)
+	test.AssertSliceContains(t, transfer.Results(), result)
+	test.AssertEqual(t, transfer.Completed(), map[string]bool{"foo.txt": true})
+}
+
+func TestTransferScheduleRetry(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	nextAttemptAt := time.Now().Add(time.Minute)
+
+	err = transfer.ScheduleRetry(nextAttemptAt)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, transfer.Status(), domain.TransferStatusRetrying)
+	test.AssertEqual(t, transfer.NextAttemptAt(), nextAttemptAt)
+}
+
+func TestTransferCancel(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	// pending transfers are canceled right away
+	pending, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = pending.Cancel()
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, pending.Status(), domain.TransferStatusCanceled)
+	test.AssertEqual(t, pending.CancelRequested(), true)
+
+	err = pending.Cancel()
+	test.AssertErrorIs(t, err, domain.ErrTransferFinished)
+
+	// running transfers keep running until their worker notices
+	running, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = running.SetStatus(domain.TransferStatusRunning)
+	test.AssertNilError(t, err)
+
+	err = running.Cancel()
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, running.Status(), domain.TransferStatusRunning)
+	test.AssertEqual(t, running.CancelRequested(), true)
+}
+
+func TestTransferRerun(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	// only finished transfers can be rerun
+	_, err = transfer.Rerun(itinerary)
+	test.AssertErrorIs(t, err, domain.ErrTransferNotFinished)
+
+	err = transfer.SetStatus(domain.TransferStatusSuccess)
+	test.AssertNilError(t, err)
+
+	rerun, err := transfer.Rerun(itinerary)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, rerun.ParentID(), transfer.ID())
+	test.AssertEqual(t, rerun.Status(), domain.TransferStatusPending)
+	test.AssertEqual(t, len(rerun.Results()), 0)
+}
+
+func TestTransferRetryFailed(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = transfer.AddResult(fileserver.TransferResult{Name: "a.txt", Dest: "a.txt"})
+	test.AssertNilError(t, err)
+
+	candidates := []string{"a.txt", "b.txt"}
+
+	// only failed (or canceled) transfers can be retried
+	_, err = transfer.RetryFailed(itinerary, candidates)
+	test.AssertErrorIs(t, err, domain.ErrTransferNotFailed)
+
+	err = transfer.SetStatus(domain.TransferStatusFailure)
+	test.AssertNilError(t, err)
+
+	retry, err := transfer.RetryFailed(itinerary, candidates)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, retry.ParentID(), transfer.ID())
+	test.AssertEqual(t, len(retry.Files()), 1)
+	test.AssertEqual(t, retry.Files()[0], "b.txt")
+
+	// nothing to retry if every file was completed
+	_, err = transfer.RetryFailed(itinerary, []string{"a.txt"})
+	test.AssertErrorIs(t, err, domain.ErrTransferNoFailures)
+}
+
+func TestTransferRetryFailedMidList(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	// a whole-pattern transfer copies "a.txt" and then fails on "b.txt"
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = transfer.AddResult(fileserver.TransferResult{Name: "a.txt", Dest: "a.txt"})
+	test.AssertNilError(t, err)
+
+	err = transfer.SetStatus(domain.TransferStatusFailure)
+	test.AssertNilError(t, err)
+
+	// the failed file and the ones it never got to are retried
+	candidates := []string{"a.txt", "b.txt", "c.txt"}
+	retry, err := transfer.RetryFailed(itinerary, candidates)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(retry.Files()), 2)
+	test.AssertSliceContains(t, retry.Files(), "b.txt")
+	test.AssertSliceContains(t, retry.Files(), "c.txt")
+}
+
+func TestTransferTimeOut(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = transfer.SetStatus(domain.TransferStatusRunning)
+	test.AssertNilError(t, err)
+
+	err = transfer.TimeOut("b.txt", domain.ErrTransferTimeout)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, transfer.Status(), domain.TransferStatusTimeout)
+	test.AssertEqual(t, transfer.StuckOn(), "b.txt")
+	test.AssertEqual(t, transfer.Error(), domain.ErrTransferTimeout.Error())
+	test.AssertEqual(t, transfer.Finished(), true)
+
+	err = transfer.TimeOut("c.txt", domain.ErrTransferTimeout)
+	test.AssertErrorIs(t, err, domain.ErrTransferFinished)
+
+	// the files that never arrived can be retried
+	retry, err := transfer.RetryFailed(itinerary, []string{"a.txt", "b.txt"})
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(retry.Files()), 2)
+}
+
+func TestTransferPriority(t *testing.T) {
+	t.Parallel()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	err = itinerary.SetPriority(5)
+	test.AssertNilError(t, err)
+
+	// the priority defaults to the itinerary's
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, transfer.Priority(), 5)
+	test.AssertEqual(t, transfer.NotBefore().IsZero(), true)
+
+	err = transfer.SetPriority(50)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, transfer.Priority(), 50)
+
+	err = transfer.SetPriority(domain.MinPriority - 1)
+	test.AssertErrorIs(t, err, domain.ErrTransferInvalidPriority)
+}
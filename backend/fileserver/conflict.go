@@ -0,0 +1,106 @@
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+var ErrExists = errors.New("fileserver: already exists")
+
+// Determines what happens when a file already exists at the destination.
+type ConflictPolicy string
+
+const (
+	ConflictOverwrite        ConflictPolicy = "overwrite"
+	ConflictSkip             ConflictPolicy = "skip"
+	ConflictFail             ConflictPolicy = "fail"
+	ConflictOverwriteIfNewer ConflictPolicy = "overwrite_if_newer"
+	ConflictRenameNumeric    ConflictPolicy = "rename_numeric"
+	ConflictRenameTimestamp  ConflictPolicy = "rename_timestamp"
+)
+
+// What was actually done with a single file during a transfer.
+type Action string
+
+const (
+	ActionCopy      Action = "copy"
+	ActionOverwrite Action = "overwrite"
+	ActionSkip      Action = "skip"
+	ActionRename    Action = "rename"
+)
+
+// Upper bound on numeric suffixes tried before giving up on a rename.
+const maxRenameAttempts = 1000
+
+// Decide where (and whether) a file should be written based on what already
+// exists at the destination. Returns the destination name and chosen action.
+func resolveConflict(to FileServer, file FileInfo, policy ConflictPolicy) (string, Action, error) {
+	existing, err := to.Stat(file.Name)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return file.Name, ActionCopy, nil
+		}
+		return "", "", err
+	}
+
+	switch policy {
+	case ConflictOverwrite, "":
+		return file.Name, ActionOverwrite, nil
+	case ConflictSkip:
+		return file.Name, ActionSkip, nil
+	case ConflictFail:
+		return "", "", fmt.Errorf("%w: %s", ErrExists, file.Name)
+	case ConflictOverwriteIfNewer:
+		if file.ModTime.After(existing.ModTime) {
+			return file.Name, ActionOverwrite, nil
+		}
+		return file.Name, ActionSkip, nil
+	case ConflictRenameNumeric:
+		name, err := findFreeName(to, file.Name)
+		if err != nil {
+			return "", "", err
+		}
+		return name, ActionRename, nil
+	case ConflictRenameTimestamp:
+		suffix := time.Now().UTC().Format("20060102T150405Z")
+		name := withSuffix(file.Name, suffix)
+
+		// fall back to numeric suffixes if the timestamped name is also taken
+		name, err := findFreeName(to, name)
+		if err != nil {
+			return "", "", err
+		}
+		return name, ActionRename, nil
+	default:
+		return "", "", fmt.Errorf("fileserver: unknown conflict policy: %s", policy)
+	}
+}
+
+// Find the first name (starting with the given one) that doesn't exist yet by
+// appending an increasing numeric suffix: foo.txt, foo-1.txt, foo-2.txt, etc.
+func findFreeName(to FileServer, name string) (string, error) {
+	candidate := name
+	for i := 1; i <= maxRenameAttempts; i++ {
+		_, err := to.Stat(candidate)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return candidate, nil
+			}
+			return "", err
+		}
+
+		candidate = withSuffix(name, fmt.Sprint(i))
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrExists, name)
+}
+
+// Insert a suffix between a file's base name and its extension.
+func withSuffix(name, suffix string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	return base + "-" + suffix + ext
+}
@@ -1,16 +1,45 @@
 package fileserver
 
-import "io"
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("fileserver: not found")
+
+// Size of a file whose length isn't known ahead of time (such as a stream).
+const UnknownSize = -1
 
 type FileInfo struct {
 	Name string
-	Size int
+	// Size may be UnknownSize when writing a stream.
+	Size    int
+	ModTime time.Time
 }
 
 // Represents an active connection to a FileServer (S3, FTP, etc).
 type FileServer interface {
 	Ping() error
 	Search(pattern string) ([]FileInfo, error)
+	Stat(name string) (FileInfo, error)
 	Read(name string) (io.Reader, error)
 	Write(info FileInfo, r io.Reader) error
 }
+
+// Implemented by FileServers whose requests can be tied to a context (so that
+// canceling it also aborts any calls that are in flight).
+type ContextBinder interface {
+	WithContext(ctx context.Context) FileServer
+}
+
+// Tie a FileServer's requests to a context (if it supports it).
+func withContext(ctx context.Context, fs FileServer) FileServer {
+	b, ok := fs.(ContextBinder)
+	if !ok {
+		return fs
+	}
+
+	return b.WithContext(ctx)
+}
@@ -42,6 +42,29 @@ func TestSearch(t *testing.T) {
 	test.AssertSliceContains(t, infos, info)
 }
 
+func TestStat(t *testing.T) {
+	t.Parallel()
+
+	fs, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	contents := "testing"
+	info := fileserver.FileInfo{
+		Name: "foo.txt",
+		Size: len(contents),
+	}
+
+	err = fs.Write(info, bytes.NewBufferString(contents))
+	test.AssertNilError(t, err)
+
+	got, err := fs.Stat("foo.txt")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got, info)
+
+	_, err = fs.Stat("bar.txt")
+	test.AssertErrorIs(t, err, fileserver.ErrNotFound)
+}
+
 func TestRead(t *testing.T) {
 	t.Parallel()
 
@@ -81,3 +104,23 @@ func TestWrite(t *testing.T) {
 	err = fs.Write(info, data)
 	test.AssertNilError(t, err)
 }
+
+func TestWriteUnknownSize(t *testing.T) {
+	t.Parallel()
+
+	fs, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	contents := "testing"
+	info := fileserver.FileInfo{
+		Name: "foo.txt",
+		Size: fileserver.UnknownSize,
+	}
+
+	err = fs.Write(info, bytes.NewBufferString(contents))
+	test.AssertNilError(t, err)
+
+	got, err := fs.Stat("foo.txt")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.Size, len(contents))
+}
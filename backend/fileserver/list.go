@@ -0,0 +1,70 @@
+package fileserver
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Which files to list (and how many of them).
+type ListOptions struct {
+	// Only list files whose names start with this prefix.
+	Prefix string
+	// Only list files whose (full) names match this pattern.
+	Pattern string
+	// Only list files whose names sort after this one.
+	After string
+	// List at most this many files (zero means no limit).
+	Limit int
+}
+
+// Implemented by FileServers that can list files in name order starting from
+// a given prefix (without having to search through every file).
+type Lister interface {
+	List(opts ListOptions) ([]FileInfo, error)
+}
+
+// List files in name order. FileServers that can't do this themselves have
+// every matching file searched for and then filtered down.
+func List(fs FileServer, opts ListOptions) ([]FileInfo, error) {
+	l, ok := fs.(Lister)
+	if ok {
+		return l.List(opts)
+	}
+
+	files, err := fs.Search(opts.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(files, func(a, b FileInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	var listed []FileInfo
+	for _, file := range files {
+		if !opts.wants(file.Name) {
+			continue
+		}
+
+		listed = append(listed, file)
+		if opts.Limit > 0 && len(listed) >= opts.Limit {
+			break
+		}
+	}
+
+	return listed, nil
+}
+
+// Check whether a file should be listed (ignoring the limit).
+func (opts ListOptions) wants(name string) bool {
+	if !strings.HasPrefix(name, opts.Prefix) {
+		return false
+	}
+	if opts.After != "" && name <= opts.After {
+		return false
+	}
+
+	matched, _ := filepath.Match(opts.Pattern, name)
+	return matched
+}
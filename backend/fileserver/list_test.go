@@ -0,0 +1,46 @@
+package fileserver_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	fs, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	names := []string{"b.txt", "incoming/c.csv", "a.txt", "incoming/a.csv", "incoming/b.txt", "incoming/d.csv"}
+	for _, name := range names {
+		err = fs.Write(fileserver.FileInfo{Name: name, Size: 4}, bytes.NewBufferString("data"))
+		test.AssertNilError(t, err)
+	}
+
+	tests := []struct {
+		name string
+		opts fileserver.ListOptions
+		want []string
+	}{
+		{"top level", fileserver.ListOptions{Pattern: "*"}, []string{"a.txt", "b.txt"}},
+		{"prefix", fileserver.ListOptions{Prefix: "incoming/", Pattern: "incoming/*"}, []string{"incoming/a.csv", "incoming/b.txt", "incoming/c.csv", "incoming/d.csv"}},
+		{"pattern", fileserver.ListOptions{Prefix: "incoming/", Pattern: "incoming/*.csv"}, []string{"incoming/a.csv", "incoming/c.csv", "incoming/d.csv"}},
+		{"page", fileserver.ListOptions{Prefix: "incoming/", Pattern: "incoming/*.csv", After: "incoming/a.csv", Limit: 1}, []string{"incoming/c.csv"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			files, err := fileserver.List(fs, tt.opts)
+			test.AssertNilError(t, err)
+			test.AssertEqual(t, len(files), len(tt.want))
+			for i, file := range files {
+				test.AssertEqual(t, file.Name, tt.want[i])
+			}
+		})
+	}
+}
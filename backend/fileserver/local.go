@@ -0,0 +1,230 @@
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ensure FileServer interface is satisfied
+var _ FileServer = (*LocalFileServer)(nil)
+
+// ensure resumable interfaces are satisfied
+var _ RangeReader = (*LocalFileServer)(nil)
+
+// ensure Deleter interface is satisfied
+var _ Deleter = (*LocalFileServer)(nil)
+
+// How long a new file must go without changing before it gets transferred.
+const DefaultSettleTime = 2 * time.Second
+
+// Prefix of the temp files used while writing (these are never listed).
+const localTempPrefix = ".dripfile-"
+
+type LocalInfo struct {
+	Root string
+	// SettleTime may be zero to use DefaultSettleTime.
+	SettleTime time.Duration
+}
+
+// File server backed by a directory on the local filesystem. Only regular
+// files directly within the root directory are considered.
+type LocalFileServer struct {
+	info LocalInfo
+}
+
+func NewLocal(info LocalInfo) (*LocalFileServer, error) {
+	if !filepath.IsAbs(info.Root) {
+		return nil, fmt.Errorf("fileserver: local root must be absolute: %s", info.Root)
+	}
+
+	fs := LocalFileServer{
+		info: info,
+	}
+	return &fs, nil
+}
+
+func (fs *LocalFileServer) Ping() error {
+	stat, err := os.Stat(fs.info.Root)
+	if err != nil {
+		return err
+	}
+
+	if !stat.IsDir() {
+		return fmt.Errorf("fileserver: local root is not a directory: %s", fs.info.Root)
+	}
+
+	return nil
+}
+
+func (fs *LocalFileServer) Search(pattern string) ([]FileInfo, error) {
+	entries, err := os.ReadDir(fs.info.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileInfo
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), localTempPrefix) {
+			continue
+		}
+
+		matched, _ := filepath.Match(pattern, entry.Name())
+		if !matched {
+			continue
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			// the file was removed after listing the directory
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		files = append(files, localFileInfo(stat))
+	}
+
+	return files, nil
+}
+
+func (fs *LocalFileServer) Stat(name string) (FileInfo, error) {
+	path, err := fs.path(name)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return FileInfo{}, ErrNotFound
+		}
+
+		return FileInfo{}, err
+	}
+
+	if !stat.Mode().IsRegular() {
+		return FileInfo{}, ErrNotFound
+	}
+
+	return localFileInfo(stat), nil
+}
+
+func (fs *LocalFileServer) Read(name string) (io.Reader, error) {
+	return fs.ReadRange(name, 0)
+}
+
+func (fs *LocalFileServer) ReadRange(name string, offset int) (io.Reader, error) {
+	path, err := fs.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	_, err = f.Seek(int64(offset), io.SeekStart)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &closeOnEOFReader{f: f}, nil
+}
+
+func (fs *LocalFileServer) Write(info FileInfo, r io.Reader) error {
+	path, err := fs.path(info.Name)
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file first so that partial files are never visible
+	tmp, err := os.CreateTemp(fs.info.Root, localTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if !info.ModTime.IsZero() {
+		err = os.Chtimes(tmp.Name(), info.ModTime, info.ModTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (fs *LocalFileServer) Delete(name string) error {
+	path, err := fs.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Resolve a file name to a path within the root (names can't escape it).
+func (fs *LocalFileServer) path(name string) (string, error) {
+	if !filepath.IsLocal(name) || filepath.Base(name) != name {
+		return "", fmt.Errorf("fileserver: invalid local file name: %s", name)
+	}
+
+	return filepath.Join(fs.info.Root, name), nil
+}
+
+func localFileInfo(stat fs.FileInfo) FileInfo {
+	return FileInfo{
+		Name:    stat.Name(),
+		Size:    int(stat.Size()),
+		ModTime: stat.ModTime(),
+	}
+}
+
+// Readers returned by the FileServer interface aren't closed by callers so
+// release the underlying file as soon as it has been fully read.
+type closeOnEOFReader struct {
+	f *os.File
+}
+
+func (r *closeOnEOFReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	if err != nil {
+		r.f.Close()
+	}
+
+	return n, err
+}
@@ -0,0 +1,155 @@
+package fileserver_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestLocal(t *testing.T) {
+	t.Parallel()
+
+	fs, err := fileserver.NewLocal(fileserver.LocalInfo{Root: t.TempDir()})
+	test.AssertNilError(t, err)
+
+	err = fs.Ping()
+	test.AssertNilError(t, err)
+
+	contents := "testing"
+	info := fileserver.FileInfo{
+		Name: "foo.txt",
+		Size: len(contents),
+	}
+
+	err = fs.Write(info, bytes.NewBufferString(contents))
+	test.AssertNilError(t, err)
+
+	infos, err := fs.Search("*.txt")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(infos), 1)
+	test.AssertEqual(t, infos[0].Name, "foo.txt")
+	test.AssertEqual(t, infos[0].Size, len(contents))
+
+	r, err := fs.ReadRange("foo.txt", 4)
+	test.AssertNilError(t, err)
+
+	got, err := io.ReadAll(r)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, string(got), "ing")
+
+	_, err = fs.Stat("bar.txt")
+	test.AssertErrorIs(t, err, fileserver.ErrNotFound)
+
+	// names can't escape the root directory
+	err = fs.Write(fileserver.FileInfo{Name: "../foo.txt"}, bytes.NewBufferString(contents))
+	test.AssertNotEqual(t, err, nil)
+}
+
+func TestLocalWatcher(t *testing.T) {
+	t.Parallel()
+
+	root := filepath.Join(t.TempDir(), "inbox")
+	err := os.Mkdir(root, 0755)
+	test.AssertNilError(t, err)
+
+	watcher, err := fileserver.NewLocalWatcher(fileserver.LocalInfo{
+		Root:       root,
+		SettleTime: 100 * time.Millisecond,
+	})
+	test.AssertNilError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settled := make(chan []fileserver.FileInfo, 8)
+	done := make(chan error)
+	go func() {
+		done <- watcher.Run(ctx, func(files []fileserver.FileInfo) {
+			settled <- files
+		})
+	}()
+
+	// give the watcher a moment to start
+	time.Sleep(50 * time.Millisecond)
+
+	err = os.WriteFile(filepath.Join(root, "foo.txt"), []byte("testing"), 0644)
+	test.AssertNilError(t, err)
+
+	files := waitSettled(t, settled)
+	test.AssertEqual(t, len(files), 1)
+	test.AssertEqual(t, files[0].Name, "foo.txt")
+	test.AssertEqual(t, files[0].Size, len("testing"))
+
+	// the watch survives the directory being recreated
+	err = os.RemoveAll(root)
+	test.AssertNilError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+
+	err = os.Mkdir(root, 0755)
+	test.AssertNilError(t, err)
+
+	err = os.WriteFile(filepath.Join(root, "bar.txt"), []byte("testing"), 0644)
+	test.AssertNilError(t, err)
+
+	files = waitSettled(t, settled)
+	test.AssertEqual(t, len(files), 1)
+	test.AssertEqual(t, files[0].Name, "bar.txt")
+
+	cancel()
+	test.AssertNilError(t, <-done)
+}
+
+func TestLocalWatcherExistingFiles(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+
+	// dropped off while nothing was watching
+	err := os.WriteFile(filepath.Join(root, "foo.txt"), []byte("testing"), 0644)
+	test.AssertNilError(t, err)
+
+	watcher, err := fileserver.NewLocalWatcher(fileserver.LocalInfo{
+		Root:       root,
+		SettleTime: 100 * time.Millisecond,
+	})
+	test.AssertNilError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settled := make(chan []fileserver.FileInfo, 8)
+	done := make(chan error)
+	go func() {
+		done <- watcher.Run(ctx, func(files []fileserver.FileInfo) {
+			settled <- files
+		})
+	}()
+
+	files := waitSettled(t, settled)
+	test.AssertEqual(t, len(files), 1)
+	test.AssertEqual(t, files[0].Name, "foo.txt")
+	test.AssertEqual(t, files[0].Size, len("testing"))
+
+	cancel()
+	test.AssertNilError(t, <-done)
+}
+
+func waitSettled(t *testing.T, settled chan []fileserver.FileInfo) []fileserver.FileInfo {
+	t.Helper()
+
+	select {
+	case files := <-settled:
+		return files
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for settled files")
+		return nil
+	}
+}
@@ -0,0 +1,164 @@
+package fileserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrDeleteNotSupported = errors.New("fileserver: delete not supported")
+
+// What happens to a source marker once its data file has been delivered.
+type MarkerAction string
+
+const (
+	MarkerActionKeep   MarkerAction = "keep"
+	MarkerActionDelete MarkerAction = "delete"
+	MarkerActionCopy   MarkerAction = "copy"
+)
+
+// Controls the "data file plus marker" handshake used by many legacy systems:
+// a data file is only ready once a marker file (such as "report.csv.done")
+// exists next to it and the receiving side waits for a marker of its own.
+type MarkerPolicy struct {
+	// Suffix of the marker that each data file requires before it can be
+	// transferred, such as ".done" or ".ok" (empty means none are required).
+	Suffix string
+	// What to do with a data file's marker after the file is delivered.
+	Action MarkerAction
+	// Name of an (empty) marker file to write at the destination once all
+	// files have landed (empty means none is written).
+	Complete string
+}
+
+var DefaultMarkerPolicy = MarkerPolicy{
+	Action: MarkerActionKeep,
+}
+
+// Implemented by FileServers that can remove files.
+type Deleter interface {
+	Delete(name string) error
+}
+
+// Remove a file (deleting a file that doesn't exist is not an error).
+func Delete(fs FileServer, name string) error {
+	d, ok := fs.(Deleter)
+	if !ok {
+		return ErrDeleteNotSupported
+	}
+
+	err := d.Delete(name)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// Check whether a file is itself a marker.
+func (p MarkerPolicy) IsMarker(name string) bool {
+	return p.Suffix != "" && strings.HasSuffix(name, p.Suffix)
+}
+
+// Name of the marker that belongs to a data file.
+func (p MarkerPolicy) MarkerFor(name string) string {
+	return name + p.Suffix
+}
+
+// Name of the data file that a marker belongs to.
+func (p MarkerPolicy) DataFor(marker string) string {
+	return strings.TrimSuffix(marker, p.Suffix)
+}
+
+// Filter out the data files that are still waiting on their markers (markers
+// themselves are kept so that callers can notice when they show up).
+func (p MarkerPolicy) Ready(from FileServer, files []FileInfo) ([]FileInfo, error) {
+	if p.Suffix == "" {
+		return files, nil
+	}
+
+	names := make(map[string]bool)
+	for _, file := range files {
+		names[file.Name] = true
+	}
+
+	var ready []FileInfo
+	for _, file := range files {
+		if !p.IsMarker(file.Name) && !names[p.MarkerFor(file.Name)] {
+			ok, err := p.ready(from, file.Name)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		ready = append(ready, file)
+	}
+
+	return ready, nil
+}
+
+// Check whether a data file is ready to be transferred.
+func (p MarkerPolicy) ready(from FileServer, name string) (bool, error) {
+	if p.Suffix == "" {
+		return true, nil
+	}
+
+	_, err := from.Stat(p.MarkerFor(name))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Handle a data file's source marker after the file has been delivered.
+func (p MarkerPolicy) handle(from, to FileServer, name, dest string) error {
+	if p.Suffix == "" {
+		return nil
+	}
+
+	marker := p.MarkerFor(name)
+	switch p.Action {
+	case MarkerActionKeep, "":
+		return nil
+	case MarkerActionDelete:
+		return Delete(from, marker)
+	case MarkerActionCopy:
+		r, err := from.Read(marker)
+		if err != nil {
+			// already handled by a previous attempt
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		info := FileInfo{
+			Name: p.MarkerFor(dest),
+			Size: UnknownSize,
+		}
+		return to.Write(info, r)
+	default:
+		return fmt.Errorf("fileserver: unknown marker action: %s", p.Action)
+	}
+}
+
+// Write the destination's completion marker (if there is one).
+func (p MarkerPolicy) complete(to FileServer) error {
+	if p.Complete == "" {
+		return nil
+	}
+
+	info := FileInfo{
+		Name: p.Complete,
+		Size: 0,
+	}
+	return to.Write(info, bytes.NewReader(nil))
+}
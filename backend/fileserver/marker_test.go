@@ -0,0 +1,185 @@
+package fileserver_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestTransferMarkerRequired(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	// only "a.csv" has its marker
+	size := 20
+	for _, name := range []string{"a.csv", "a.csv.done", "b.csv"} {
+		err = from.Write(
+			fileserver.FileInfo{Name: name, Size: size},
+			bytes.NewBufferString(random.String(size)),
+		)
+		test.AssertNilError(t, err)
+	}
+
+	opts := fileserver.TransferOptions{
+		Marker: fileserver.MarkerPolicy{
+			Suffix: ".done",
+			Action: fileserver.MarkerActionKeep,
+		},
+	}
+	totalBytes, err := fileserver.Transfer(context.Background(), "*", from, to, opts)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, totalBytes, size)
+
+	// the marker itself isn't transferred
+	files, err := to.Search("*")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(files), 1)
+	test.AssertEqual(t, files[0].Name, "a.csv")
+
+	_, err = from.Stat("a.csv.done")
+	test.AssertNilError(t, err)
+}
+
+func TestTransferMarkerActions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		action     fileserver.MarkerAction
+		sourceKept bool
+		destCopied bool
+	}{
+		{fileserver.MarkerActionKeep, true, false},
+		{fileserver.MarkerActionDelete, false, false},
+		{fileserver.MarkerActionCopy, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.action), func(t *testing.T) {
+			t.Parallel()
+
+			random := test.NewRandom()
+
+			from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+			test.AssertNilError(t, err)
+
+			to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+			test.AssertNilError(t, err)
+
+			size := 20
+			for _, name := range []string{"a.csv", "a.csv.ok"} {
+				err = from.Write(
+					fileserver.FileInfo{Name: name, Size: size},
+					bytes.NewBufferString(random.String(size)),
+				)
+				test.AssertNilError(t, err)
+			}
+
+			opts := fileserver.TransferOptions{
+				Marker: fileserver.MarkerPolicy{
+					Suffix:   ".ok",
+					Action:   tt.action,
+					Complete: "_SUCCESS",
+				},
+			}
+			_, err = fileserver.Transfer(context.Background(), "*", from, to, opts)
+			test.AssertNilError(t, err)
+
+			_, err = from.Stat("a.csv.ok")
+			test.AssertEqual(t, err == nil, tt.sourceKept)
+
+			_, err = to.Stat("a.csv.ok")
+			test.AssertEqual(t, err == nil, tt.destCopied)
+
+			// the completion marker is written once everything has landed
+			_, err = to.Stat("_SUCCESS")
+			test.AssertNilError(t, err)
+		})
+	}
+}
+
+func TestTransferMarkerNothingReady(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	size := 20
+	err = from.Write(
+		fileserver.FileInfo{Name: "a.csv", Size: size},
+		bytes.NewBufferString(random.String(size)),
+	)
+	test.AssertNilError(t, err)
+
+	opts := fileserver.TransferOptions{
+		Marker: fileserver.MarkerPolicy{
+			Suffix:   ".done",
+			Complete: "_SUCCESS",
+		},
+	}
+	totalBytes, err := fileserver.Transfer(context.Background(), "*", from, to, opts)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, totalBytes, 0)
+
+	// no completion marker is written when nothing was delivered
+	_, err = to.Stat("_SUCCESS")
+	test.AssertErrorIs(t, err, fileserver.ErrNotFound)
+}
+
+func TestMarkerReady(t *testing.T) {
+	t.Parallel()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	marker := fileserver.MarkerPolicy{
+		Suffix: ".done",
+		Action: fileserver.MarkerActionKeep,
+	}
+
+	err = from.Write(fileserver.FileInfo{Name: "a.csv", Size: 0}, bytes.NewReader(nil))
+	test.AssertNilError(t, err)
+
+	// the data file waits until its marker exists
+	files, err := from.Search("*.csv")
+	test.AssertNilError(t, err)
+
+	ready, err := marker.Ready(from, files)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(ready), 0)
+
+	err = from.Write(fileserver.FileInfo{Name: "a.csv.done", Size: 0}, bytes.NewReader(nil))
+	test.AssertNilError(t, err)
+
+	// markers are found even when the search doesn't include them
+	files, err = from.Search("*.csv")
+	test.AssertNilError(t, err)
+
+	ready, err = marker.Ready(from, files)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(ready), 1)
+	test.AssertEqual(t, ready[0].Name, "a.csv")
+
+	// and markers themselves are kept
+	files, err = from.Search("*")
+	test.AssertNilError(t, err)
+
+	ready, err = marker.Ready(from, files)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(ready), 2)
+	test.AssertEqual(t, marker.DataFor("a.csv.done"), "a.csv")
+}
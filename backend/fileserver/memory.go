@@ -2,17 +2,26 @@ package fileserver
 
 import (
 	"bytes"
-	"errors"
 	"io"
 	"path/filepath"
 	"sync"
-)
 
-var ErrNotFound = errors.New("fileserver: not found")
+	"github.com/google/uuid"
+)
 
 // ensure FileServer interface is satisfied
 var _ FileServer = (*MemoryFileServer)(nil)
 
+// ensure resumable interfaces are satisfied
+var _ RangeReader = (*MemoryFileServer)(nil)
+var _ ResumableWriter = (*MemoryFileServer)(nil)
+
+// ensure Deleter interface is satisfied
+var _ Deleter = (*MemoryFileServer)(nil)
+
+// Size of each committed part when writing resumable uploads.
+const memoryPartSize = 4 * 1024
+
 type MemoryInfo struct{}
 
 type file struct {
@@ -22,14 +31,16 @@ type file struct {
 
 type MemoryFileServer struct {
 	sync.RWMutex
-	info  MemoryInfo
-	files map[string]file
+	info    MemoryInfo
+	files   map[string]file
+	uploads map[string]*bytes.Buffer
 }
 
 func NewMemory(info MemoryInfo) (*MemoryFileServer, error) {
 	fs := MemoryFileServer{
-		info:  info,
-		files: make(map[string]file),
+		info:    info,
+		files:   make(map[string]file),
+		uploads: make(map[string]*bytes.Buffer),
 	}
 
 	return &fs, nil
@@ -56,6 +67,18 @@ func (fs *MemoryFileServer) Search(pattern string) ([]FileInfo, error) {
 	return files, nil
 }
 
+func (fs *MemoryFileServer) Stat(name string) (FileInfo, error) {
+	fs.RLock()
+	defer fs.RUnlock()
+
+	file, ok := fs.files[name]
+	if !ok {
+		return FileInfo{}, ErrNotFound
+	}
+
+	return file.info, nil
+}
+
 func (fs *MemoryFileServer) Read(name string) (io.Reader, error) {
 	fs.RLock()
 	defer fs.RUnlock()
@@ -65,7 +88,8 @@ func (fs *MemoryFileServer) Read(name string) (io.Reader, error) {
 		return nil, ErrNotFound
 	}
 
-	return file.data, nil
+	// each read starts from the beginning (rather than draining the file)
+	return bytes.NewReader(file.data.Bytes()), nil
 }
 
 func (fs *MemoryFileServer) Write(info FileInfo, r io.Reader) error {
@@ -77,6 +101,9 @@ func (fs *MemoryFileServer) Write(info FileInfo, r io.Reader) error {
 		return err
 	}
 
+	// record the number of bytes actually written (the size may be unknown)
+	info.Size = len(buf)
+
 	fs.files[info.Name] = file{
 		info: info,
 		data: bytes.NewBuffer(buf),
@@ -84,3 +111,107 @@ func (fs *MemoryFileServer) Write(info FileInfo, r io.Reader) error {
 
 	return nil
 }
+
+func (fs *MemoryFileServer) Delete(name string) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	_, ok := fs.files[name]
+	if !ok {
+		return ErrNotFound
+	}
+
+	delete(fs.files, name)
+	return nil
+}
+
+func (fs *MemoryFileServer) ReadRange(name string, offset int) (io.Reader, error) {
+	fs.RLock()
+	defer fs.RUnlock()
+
+	file, ok := fs.files[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	data := file.data.Bytes()
+	offset = min(offset, len(data))
+
+	return bytes.NewReader(data[offset:]), nil
+}
+
+func (fs *MemoryFileServer) WriteResumable(info FileInfo, r io.Reader, partial Partial, commit func(Partial) error) error {
+	fs.Lock()
+
+	// start a new upload unless resuming an existing one
+	if partial.UploadID == "" {
+		partial.UploadID = uuid.NewString()
+		partial.Offset = 0
+		fs.uploads[partial.UploadID] = new(bytes.Buffer)
+	}
+
+	upload, ok := fs.uploads[partial.UploadID]
+	if !ok || partial.Offset > upload.Len() {
+		fs.Unlock()
+		return ErrUploadNotFound
+	}
+
+	// discard anything written after the last committed offset
+	upload.Truncate(partial.Offset)
+	fs.Unlock()
+
+	err := commit(partial)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, memoryPartSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		if n > 0 {
+			fs.Lock()
+			upload.Write(buf[:n])
+			fs.Unlock()
+
+			partial.Offset += n
+			commitErr := commit(partial)
+			if commitErr != nil {
+				return commitErr
+			}
+		}
+
+		// a short (or empty) read means the source has been exhausted
+		if err != nil {
+			break
+		}
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	info.Size = upload.Len()
+	fs.files[info.Name] = file{
+		info: info,
+		data: upload,
+	}
+	delete(fs.uploads, partial.UploadID)
+
+	return nil
+}
+
+func (fs *MemoryFileServer) AbortResumable(partial Partial) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	_, ok := fs.uploads[partial.UploadID]
+	if !ok {
+		return ErrUploadNotFound
+	}
+
+	delete(fs.uploads, partial.UploadID)
+	return nil
+}
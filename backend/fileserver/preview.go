@@ -0,0 +1,78 @@
+package fileserver
+
+import (
+	"errors"
+)
+
+// Why a matching file would be left alone by a transfer.
+const (
+	PreviewReasonExists        = "exists at destination"
+	PreviewReasonWouldFail     = "exists at destination (the transfer would fail)"
+	PreviewReasonMarkerMissing = "waiting for marker"
+)
+
+// What a transfer would do with a single file.
+type PreviewResult struct {
+	Name   string
+	Dest   string
+	Size   int
+	Action Action
+	// Why the file wouldn't be written (empty if it would be).
+	Reason string
+}
+
+// Work out what a transfer would do with each file matching a given pattern
+// (including where it would end up) without writing anything. Completed files
+// and partial copies are ignored since a preview is of a fresh transfer.
+func Preview(pattern string, from, to FileServer, opts TransferOptions) ([]PreviewResult, error) {
+	files, err := from.Search(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []PreviewResult
+	for _, file := range files {
+		if !opts.wants(file.Name) {
+			continue
+		}
+
+		result := PreviewResult{
+			Name: file.Name,
+			Dest: file.Name,
+			Size: file.Size,
+		}
+
+		ready, err := opts.Marker.ready(from, file.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !ready {
+			result.Action = ActionSkip
+			result.Reason = PreviewReasonMarkerMissing
+			results = append(results, result)
+			continue
+		}
+
+		dest, action, err := resolveConflict(to, file, opts.Conflict)
+		if err != nil {
+			if !errors.Is(err, ErrExists) {
+				return nil, err
+			}
+
+			result.Action = ActionSkip
+			result.Reason = PreviewReasonWouldFail
+			results = append(results, result)
+			continue
+		}
+
+		result.Dest = dest
+		result.Action = action
+		if action == ActionSkip {
+			result.Reason = PreviewReasonExists
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,81 @@
+package fileserver_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestPreview(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	size := 20
+	for _, name := range []string{"new.csv", "old.csv", "old.csv.done", "new.csv.done", "late.csv", "notes.txt"} {
+		err = from.Write(
+			fileserver.FileInfo{Name: name, Size: size},
+			bytes.NewBufferString(random.String(size)),
+		)
+		test.AssertNilError(t, err)
+	}
+
+	err = to.Write(
+		fileserver.FileInfo{Name: "old.csv", Size: size},
+		bytes.NewBufferString(random.String(size)),
+	)
+	test.AssertNilError(t, err)
+
+	tests := []struct {
+		conflict fileserver.ConflictPolicy
+		old      fileserver.PreviewResult
+	}{
+		{fileserver.ConflictOverwrite, fileserver.PreviewResult{Dest: "old.csv", Action: fileserver.ActionOverwrite}},
+		{fileserver.ConflictSkip, fileserver.PreviewResult{Dest: "old.csv", Action: fileserver.ActionSkip, Reason: fileserver.PreviewReasonExists}},
+		{fileserver.ConflictFail, fileserver.PreviewResult{Dest: "old.csv", Action: fileserver.ActionSkip, Reason: fileserver.PreviewReasonWouldFail}},
+		{fileserver.ConflictRenameNumeric, fileserver.PreviewResult{Dest: "old-1.csv", Action: fileserver.ActionRename}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.conflict), func(t *testing.T) {
+			t.Parallel()
+
+			opts := fileserver.TransferOptions{
+				Conflict: tt.conflict,
+				Marker: fileserver.MarkerPolicy{
+					Suffix: ".done",
+				},
+			}
+			results, err := fileserver.Preview("*.csv", from, to, opts)
+			test.AssertNilError(t, err)
+			test.AssertEqual(t, len(results), 3)
+
+			byName := make(map[string]fileserver.PreviewResult)
+			for _, result := range results {
+				byName[result.Name] = result
+			}
+
+			test.AssertEqual(t, byName["new.csv"].Action, fileserver.ActionCopy)
+			test.AssertEqual(t, byName["new.csv"].Size, size)
+			test.AssertEqual(t, byName["late.csv"].Reason, fileserver.PreviewReasonMarkerMissing)
+
+			old := byName["old.csv"]
+			test.AssertEqual(t, old.Dest, tt.old.Dest)
+			test.AssertEqual(t, old.Action, tt.old.Action)
+			test.AssertEqual(t, old.Reason, tt.old.Reason)
+
+			// nothing was written to the destination
+			files, err := to.Search("*")
+			test.AssertNilError(t, err)
+			test.AssertEqual(t, len(files), 1)
+		})
+	}
+}
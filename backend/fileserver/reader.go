@@ -0,0 +1,120 @@
+package fileserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Wrap a reader so that it stops with the context's error once the context
+// is cancelled (even if the underlying reader knows nothing about contexts).
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	cr := contextReader{
+		ctx: ctx,
+		r:   r,
+	}
+	return &cr
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	err := cr.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	return cr.r.Read(p)
+}
+
+type countingReader struct {
+	r   io.Reader
+	n   int
+	eof bool
+}
+
+// Wrap a reader and keep track of how many bytes have been read through it.
+func newCountingReader(r io.Reader) *countingReader {
+	cr := countingReader{
+		r: r,
+	}
+	return &cr
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += n
+	if err == io.EOF {
+		cr.eof = true
+	}
+	return n, err
+}
+
+type progressReader struct {
+	r        io.Reader
+	progress func()
+}
+
+// Wrap a reader and call progress each time any bytes are read through it.
+func newProgressReader(r io.Reader, progress func()) io.Reader {
+	pr := progressReader{
+		r:        r,
+		progress: progress,
+	}
+	return &pr
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.progress()
+	}
+	return n, err
+}
+
+// Close a reader (if it can be) once the context is done, which unblocks
+// reads that are stuck on a hung connection. Call the returned func once the
+// reader is no longer in use.
+func closeOnDone(ctx context.Context, r io.Reader) func() bool {
+	c, ok := r.(io.Closer)
+	if !ok {
+		return func() bool { return false }
+	}
+
+	return context.AfterFunc(ctx, func() {
+		c.Close()
+	})
+}
+
+// Running SHA-256 of a file's contents as it is copied.
+type digest struct {
+	h hash.Hash
+	// part of the file was copied by an earlier run (so the sum is unknown)
+	incomplete bool
+}
+
+func newDigest() *digest {
+	d := digest{
+		h: sha256.New(),
+	}
+	return &d
+}
+
+// Wrap a reader so that everything read through it is added to the digest.
+func (d *digest) reader(r io.Reader) io.Reader {
+	return io.TeeReader(r, d.h)
+}
+
+// Hex-encoded checksum of the file (empty if only part of it was seen).
+func (d *digest) sum() string {
+	if d.incomplete {
+		return ""
+	}
+
+	return hex.EncodeToString(d.h.Sum(nil))
+}
@@ -0,0 +1,49 @@
+package fileserver
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrUploadNotFound = errors.New("fileserver: upload not found")
+
+// Files at least this large are copied in resumable parts (when supported).
+const DefaultResumeThreshold = 64 * 1024 * 1024
+
+// Checkpoint state for a file that was only partially copied.
+type Partial struct {
+	Name     string
+	Dest     string
+	Action   Action
+	UploadID string
+	Offset   int
+}
+
+// Implemented by FileServers that can start reading a file at an offset.
+type RangeReader interface {
+	ReadRange(name string, offset int) (io.Reader, error)
+}
+
+// Implemented by FileServers that can write a file as a series of committed
+// parts and later pick up an interrupted upload where it left off. The reader
+// must start at the partial's offset and commit is called after each part.
+// Uploads that will never be resumed should be aborted to free their storage.
+type ResumableWriter interface {
+	WriteResumable(info FileInfo, r io.Reader, partial Partial, commit func(Partial) error) error
+	AbortResumable(partial Partial) error
+}
+
+// Discard the in-progress upload behind a partial copy (if there is one).
+func AbortPartial(fs FileServer, partial Partial) error {
+	rw, ok := fs.(ResumableWriter)
+	if !ok || partial.UploadID == "" {
+		return nil
+	}
+
+	err := rw.AbortResumable(partial)
+	if errors.Is(err, ErrUploadNotFound) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,88 @@
+package fileserver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Controls how many times (and how often) failed work gets retried.
+type RetryPolicy struct {
+	// Total number of attempts (including the first one).
+	MaxAttempts int
+	// Delay before the first retry.
+	InitialDelay time.Duration
+	// Multiplier applied to the delay after each retry.
+	BackoffFactor float64
+	// Fraction of each delay (0 to 1) that is randomized.
+	Jitter float64
+}
+
+// Retries of a whole transfer (which gets rescheduled and frees up its worker).
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:   3,
+	InitialDelay:  30 * time.Second,
+	BackoffFactor: 2,
+	Jitter:        0.2,
+}
+
+// Retries of a single file within a running transfer. These are kept short
+// since the transfer holds onto its lease (and worker slot) while waiting.
+var DefaultFileRetryPolicy = RetryPolicy{
+	MaxAttempts:   3,
+	InitialDelay:  1 * time.Second,
+	BackoffFactor: 2,
+	Jitter:        0.2,
+}
+
+// How long to wait after the given (1-based) attempt before trying again.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	attempt = max(attempt, 1)
+
+	delay := float64(p.InitialDelay) * math.Pow(max(p.BackoffFactor, 1), float64(attempt-1))
+	if p.Jitter > 0 {
+		// spread the delay evenly across [delay - jitter, delay + jitter]
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// Errors that will never succeed no matter how many times they are retried.
+func IsPermanent(err error) bool {
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		return true
+	case errors.Is(err, ErrInvalidBucket):
+		return true
+	case errors.Is(err, ErrExists):
+		return true
+	case errors.Is(err, ErrDeleteNotSupported):
+		return true
+	case errors.Is(err, ErrIdleTimeout):
+		return true
+	default:
+		return false
+	}
+}
+
+// Call fn until it succeeds, fails permanently, or runs out of attempts.
+func retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || IsPermanent(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(policy.Delay(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
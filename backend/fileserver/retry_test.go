@@ -0,0 +1,50 @@
+package fileserver_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	t.Parallel()
+
+	policy := fileserver.RetryPolicy{
+		MaxAttempts:   5,
+		InitialDelay:  time.Second,
+		BackoffFactor: 2,
+	}
+
+	test.AssertEqual(t, policy.Delay(1), time.Second)
+	test.AssertEqual(t, policy.Delay(2), 2*time.Second)
+	test.AssertEqual(t, policy.Delay(3), 4*time.Second)
+}
+
+func TestRetryPolicyDelayJitter(t *testing.T) {
+	t.Parallel()
+
+	policy := fileserver.RetryPolicy{
+		MaxAttempts:   5,
+		InitialDelay:  time.Second,
+		BackoffFactor: 2,
+		Jitter:        0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(2)
+		if delay < time.Second || delay > 3*time.Second {
+			t.Fatalf("got %v; want between 1s and 3s", delay)
+		}
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	t.Parallel()
+
+	test.AssertEqual(t, fileserver.IsPermanent(fileserver.ErrInvalidCredentials), true)
+	test.AssertEqual(t, fileserver.IsPermanent(fileserver.ErrExists), true)
+	test.AssertEqual(t, fileserver.IsPermanent(errors.New("connection reset")), false)
+}
@@ -1,6 +1,7 @@
 package fileserver
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -8,6 +9,7 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -16,6 +18,35 @@ import (
 // ensure FileServer interface is satisfied
 var _ FileServer = (*S3FileServer)(nil)
 
+// ensure resumable interfaces are satisfied
+var _ RangeReader = (*S3FileServer)(nil)
+var _ ResumableWriter = (*S3FileServer)(nil)
+
+// ensure Deleter interface is satisfied
+var _ Deleter = (*S3FileServer)(nil)
+
+// ensure ContextBinder interface is satisfied
+var _ ContextBinder = (*S3FileServer)(nil)
+
+// ensure Lister interface is satisfied
+var _ Lister = (*S3FileServer)(nil)
+
+// Size of each part in a resumable (multipart) upload. S3 requires all
+// parts except the last one to be at least 5MB.
+const s3PartSize = 16 * 1024 * 1024
+
+// Limits on the configurable part size of streaming (multipart) uploads. S3
+// itself allows parts of up to 5GB but each part is buffered in memory (once
+// per concurrent upload) so the max is kept much lower.
+const (
+	S3MinPartSize = 5 * 1024 * 1024
+	S3MaxPartSize = 256 * 1024 * 1024
+)
+
+// How long to spend cleaning up after a failed upload (which happens even if
+// the upload's own context was canceled).
+const s3AbortTimeout = 30 * time.Second
+
 var (
 	ErrInvalidEndpoint    = errors.New("s3: invalid endpoint")
 	ErrInvalidCredentials = errors.New("s3: invalid credentials")
@@ -27,11 +58,19 @@ type S3Info struct {
 	Bucket          string
 	AccessKeyID     string
 	SecretAccessKey string
+
+	// Size of each part and number of parts uploaded in parallel when
+	// streaming large files (zero uses the defaults).
+	PartSize    int
+	Concurrency int
 }
 
 type S3FileServer struct {
 	info   S3Info
 	client *minio.Client
+
+	// requests are made within this context (nil means background)
+	ctx context.Context
 }
 
 func NewS3(info S3Info) (*S3FileServer, error) {
@@ -66,8 +105,23 @@ func NewS3(info S3Info) (*S3FileServer, error) {
 	return &fs, nil
 }
 
+// Make a copy of this FileServer whose requests are canceled along with ctx.
+func (fs *S3FileServer) WithContext(ctx context.Context) FileServer {
+	bound := *fs
+	bound.ctx = ctx
+	return &bound
+}
+
+func (fs *S3FileServer) requestContext() context.Context {
+	if fs.ctx == nil {
+		return context.Background()
+	}
+
+	return fs.ctx
+}
+
 func (fs *S3FileServer) Ping() error {
-	ctx := context.Background()
+	ctx := fs.requestContext()
 	buckets, err := fs.client.ListBuckets(ctx)
 	if err != nil {
 		return checkError(err)
@@ -85,7 +139,7 @@ func (fs *S3FileServer) Ping() error {
 }
 
 func (fs *S3FileServer) Search(pattern string) ([]FileInfo, error) {
-	ctx := context.Background()
+	ctx := fs.requestContext()
 	objects := fs.client.ListObjects(
 		ctx,
 		fs.info.Bucket,
@@ -105,8 +159,9 @@ func (fs *S3FileServer) Search(pattern string) ([]FileInfo, error) {
 		}
 
 		file := FileInfo{
-			Name: object.Key,
-			Size: int(object.Size),
+			Name:    object.Key,
+			Size:    int(object.Size),
+			ModTime: object.LastModified,
 		}
 		files = append(files, file)
 	}
@@ -114,8 +169,70 @@ func (fs *S3FileServer) Search(pattern string) ([]FileInfo, error) {
 	return files, nil
 }
 
+// List objects beneath a prefix (including any nested keys). S3 returns keys
+// in name order so listing stops as soon as the limit is reached.
+func (fs *S3FileServer) List(opts ListOptions) ([]FileInfo, error) {
+	ctx, cancel := context.WithCancel(fs.requestContext())
+	defer cancel()
+
+	objects := fs.client.ListObjects(
+		ctx,
+		fs.info.Bucket,
+		minio.ListObjectsOptions{
+			Prefix:     opts.Prefix,
+			StartAfter: opts.After,
+			Recursive:  true,
+		},
+	)
+
+	var files []FileInfo
+	for object := range objects {
+		err := object.Err
+		if err != nil {
+			return nil, checkError(err)
+		}
+
+		if !opts.wants(object.Key) {
+			continue
+		}
+
+		file := FileInfo{
+			Name:    object.Key,
+			Size:    int(object.Size),
+			ModTime: object.LastModified,
+		}
+		files = append(files, file)
+
+		if opts.Limit > 0 && len(files) >= opts.Limit {
+			break
+		}
+	}
+
+	return files, nil
+}
+
+func (fs *S3FileServer) Stat(name string) (FileInfo, error) {
+	ctx := fs.requestContext()
+	object, err := fs.client.StatObject(
+		ctx,
+		fs.info.Bucket,
+		name,
+		minio.StatObjectOptions{},
+	)
+	if err != nil {
+		return FileInfo{}, checkError(err)
+	}
+
+	file := FileInfo{
+		Name:    object.Key,
+		Size:    int(object.Size),
+		ModTime: object.LastModified,
+	}
+	return file, nil
+}
+
 func (fs *S3FileServer) Read(name string) (io.Reader, error) {
-	ctx := context.Background()
+	ctx := fs.requestContext()
 	obj, err := fs.client.GetObject(
 		ctx,
 		fs.info.Bucket,
@@ -130,13 +247,175 @@ func (fs *S3FileServer) Read(name string) (io.Reader, error) {
 }
 
 func (fs *S3FileServer) Write(file FileInfo, r io.Reader) error {
-	ctx := context.Background()
+	ctx := fs.requestContext()
+
+	size := int64(file.Size)
+	if file.Size < 0 {
+		// peek at the start of the stream: streams that fit within it are
+		// uploaded in a single request while anything larger becomes a
+		// multipart upload (the peek is capped to avoid huge allocations)
+		buf := make([]byte, min(fs.partSize(), s3PartSize))
+		n, err := io.ReadFull(r, buf)
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			r = bytes.NewReader(buf[:n])
+			size = int64(n)
+		case err != nil:
+			return err
+		default:
+			r = io.MultiReader(bytes.NewReader(buf), r)
+			size = -1
+		}
+	}
+
+	opts := minio.PutObjectOptions{
+		PartSize: uint64(fs.partSize()),
+	}
+	if fs.info.Concurrency > 0 {
+		opts.NumThreads = uint(fs.info.Concurrency)
+		opts.ConcurrentStreamParts = fs.info.Concurrency > 1
+	}
+
 	_, err := fs.client.PutObject(
 		ctx,
 		fs.info.Bucket,
 		file.Name,
 		r,
-		int64(file.Size),
+		size,
+		opts,
+	)
+	if err != nil {
+		// the client's own abort uses ctx (which fails if it was canceled) so
+		// clean up any multipart upload that was left behind separately
+		abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s3AbortTimeout)
+		defer cancel()
+
+		abortErr := fs.client.RemoveIncompleteUpload(abortCtx, fs.info.Bucket, file.Name)
+		if abortErr != nil {
+			return errors.Join(checkError(err), abortErr)
+		}
+
+		return checkError(err)
+	}
+
+	return nil
+}
+
+func (fs *S3FileServer) Delete(name string) error {
+	ctx := fs.requestContext()
+	err := fs.client.RemoveObject(
+		ctx,
+		fs.info.Bucket,
+		name,
+		minio.RemoveObjectOptions{},
+	)
+	if err != nil {
+		return checkError(err)
+	}
+
+	return nil
+}
+
+func (fs *S3FileServer) ReadRange(name string, offset int) (io.Reader, error) {
+	ctx := fs.requestContext()
+
+	opts := minio.GetObjectOptions{}
+	if offset > 0 {
+		err := opts.SetRange(int64(offset), 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	obj, err := fs.client.GetObject(
+		ctx,
+		fs.info.Bucket,
+		name,
+		opts,
+	)
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	return obj, nil
+}
+
+func (fs *S3FileServer) WriteResumable(info FileInfo, r io.Reader, partial Partial, commit func(Partial) error) error {
+	ctx := fs.requestContext()
+	core := minio.Core{Client: fs.client}
+
+	if partial.UploadID == "" {
+		// start a new multipart upload
+		uploadID, err := core.NewMultipartUpload(ctx, fs.info.Bucket, info.Name, minio.PutObjectOptions{})
+		if err != nil {
+			return checkError(err)
+		}
+
+		partial.UploadID = uploadID
+		partial.Offset = 0
+	} else {
+		// ensure the upload being resumed still exists
+		_, err := fs.listParts(ctx, core, info.Name, partial.UploadID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := commit(partial)
+	if err != nil {
+		return err
+	}
+
+	// committed offsets always land on part boundaries (except for the final
+	// part) so the next part number can be derived from the offset
+	buf := make([]byte, s3PartSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		if n > 0 {
+			partNumber := partial.Offset/s3PartSize + 1
+			_, putErr := core.PutObjectPart(
+				ctx,
+				fs.info.Bucket,
+				info.Name,
+				partial.UploadID,
+				partNumber,
+				bytes.NewReader(buf[:n]),
+				int64(n),
+				minio.PutObjectPartOptions{},
+			)
+			if putErr != nil {
+				return checkError(putErr)
+			}
+
+			partial.Offset += n
+			commitErr := commit(partial)
+			if commitErr != nil {
+				return commitErr
+			}
+		}
+
+		// a short (or empty) read means the source has been exhausted
+		if err != nil {
+			break
+		}
+	}
+
+	// gather all parts (including those from previous runs) and finish up
+	parts, err := fs.listParts(ctx, core, info.Name, partial.UploadID)
+	if err != nil {
+		return err
+	}
+
+	_, err = core.CompleteMultipartUpload(
+		ctx,
+		fs.info.Bucket,
+		info.Name,
+		partial.UploadID,
+		parts,
 		minio.PutObjectOptions{},
 	)
 	if err != nil {
@@ -146,6 +425,52 @@ func (fs *S3FileServer) Write(file FileInfo, r io.Reader) error {
 	return nil
 }
 
+func (fs *S3FileServer) AbortResumable(partial Partial) error {
+	ctx := fs.requestContext()
+	core := minio.Core{Client: fs.client}
+
+	err := core.AbortMultipartUpload(ctx, fs.info.Bucket, partial.Dest, partial.UploadID)
+	if err != nil {
+		return checkError(err)
+	}
+
+	return nil
+}
+
+func (fs *S3FileServer) partSize() int {
+	if fs.info.PartSize > 0 {
+		return fs.info.PartSize
+	}
+
+	return s3PartSize
+}
+
+func (fs *S3FileServer) listParts(ctx context.Context, core minio.Core, name, uploadID string) ([]minio.CompletePart, error) {
+	var parts []minio.CompletePart
+
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, fs.info.Bucket, name, uploadID, marker, 1000)
+		if err != nil {
+			return nil, checkError(err)
+		}
+
+		for _, part := range result.ObjectParts {
+			parts = append(parts, minio.CompletePart{
+				PartNumber: part.PartNumber,
+				ETag:       part.ETag,
+			})
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+
+	return parts, nil
+}
+
 func checkError(err error) error {
 	// check for net.Error first (invalid / unreachable endpoint)
 	if _, ok := err.(net.Error); ok {
@@ -166,6 +491,12 @@ func checkError(err error) error {
 	if s3Err.Code == "NoSuchBucket" {
 		return ErrInvalidBucket
 	}
+	if s3Err.Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	if s3Err.Code == "NoSuchUpload" {
+		return ErrUploadNotFound
+	}
 
 	// else bubble
 	return err
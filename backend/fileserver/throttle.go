@@ -0,0 +1,88 @@
+package fileserver
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// Create a token bucket that allows up to the given number of bytes per
+// second (with a burst of up to one second's worth of data). Returns nil
+// (unlimited) if the rate isn't positive.
+func NewLimiter(bytesPerSecond int) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), bytesPerSecond)
+}
+
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rate.Limiter
+}
+
+// Wrap a reader so that it never reads faster than any of the given limiters
+// allow. Nil limiters are ignored (unlimited).
+func NewThrottledReader(ctx context.Context, r io.Reader, limiters ...*rate.Limiter) io.Reader {
+	var active []*rate.Limiter
+	for _, limiter := range limiters {
+		if limiter != nil {
+			active = append(active, limiter)
+		}
+	}
+
+	if len(active) == 0 {
+		return r
+	}
+
+	tr := throttledReader{
+		ctx:      ctx,
+		r:        r,
+		limiters: active,
+	}
+	return &tr
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	// never read more than the smallest bucket can hold at once
+	for _, limiter := range tr.limiters {
+		if limiter.Burst() > 0 && len(p) > limiter.Burst() {
+			p = p[:limiter.Burst()]
+		}
+	}
+
+	n, err := tr.r.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	// wait for enough tokens (bytes) to become available in every bucket
+	for _, limiter := range tr.limiters {
+		waitErr := waitN(tr.ctx, limiter, n)
+		if waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
+
+// Wait for n tokens in chunks no bigger than the limiter's burst. The burst is
+// checked each time since it shrinks if the limit is lowered mid-read (and
+// waiting for more than the burst at once is an error).
+func waitN(ctx context.Context, limiter *rate.Limiter, n int) error {
+	for n > 0 {
+		chunk := min(n, max(limiter.Burst(), 1))
+		err := limiter.WaitN(ctx, chunk)
+		if err != nil {
+			return err
+		}
+
+		n -= chunk
+	}
+
+	return nil
+}
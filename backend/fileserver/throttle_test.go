@@ -0,0 +1,82 @@
+package fileserver_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestThrottledReader(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	// 64KB/s with 96KB of data should take at least half a second
+	rate := 64 * 1024
+	data := random.Bytes(96 * 1024)
+
+	limiter := fileserver.NewLimiter(rate)
+	r := fileserver.NewThrottledReader(context.Background(), bytes.NewReader(data), limiter, nil)
+
+	start := time.Now()
+	buf, err := io.ReadAll(r)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, buf, data)
+
+	elapsed := time.Since(start)
+	if elapsed < 400*time.Millisecond {
+		t.Fatalf("got %v; want at least 400ms", elapsed)
+	}
+}
+
+func TestThrottledReaderUnlimited(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("testing")
+	r := fileserver.NewThrottledReader(context.Background(), bytes.NewReader(data), nil)
+
+	buf, err := io.ReadAll(r)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, buf, data)
+}
+
+// Lowers a limiter's burst while a read is in flight.
+type shrinkingReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+	burst   int
+}
+
+func (sr *shrinkingReader) Read(p []byte) (int, error) {
+	sr.limiter.SetBurst(sr.burst)
+	return sr.r.Read(p)
+}
+
+func TestThrottledReaderBurstLowered(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	data := random.Bytes(64 * 1024)
+
+	limiter := fileserver.NewLimiter(1024 * 1024)
+	sr := &shrinkingReader{
+		r:       bytes.NewReader(data),
+		limiter: limiter,
+		burst:   1024,
+	}
+	r := fileserver.NewThrottledReader(context.Background(), sr, limiter)
+
+	// a single read bigger than the lowered burst slows down instead of failing
+	buf := make([]byte, len(data))
+	n, err := r.Read(buf)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, buf[:n], data)
+}
@@ -0,0 +1,122 @@
+package fileserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrIdleTimeout = errors.New("fileserver: no progress within idle timeout")
+
+// Error from copying a specific file.
+type FileError struct {
+	Name string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Keeps track of a single copy's progress (and whether it was abandoned).
+type watchdog struct {
+	// unix nanos of the last time any bytes were read
+	last atomic.Int64
+
+	mu        sync.Mutex
+	abandoned bool
+}
+
+func (wd *watchdog) progress() {
+	wd.last.Store(time.Now().UnixNano())
+}
+
+func (wd *watchdog) idleFor() time.Duration {
+	return time.Since(time.Unix(0, wd.last.Load()))
+}
+
+// Call fn unless the copy has been abandoned (so that a copy which finally
+// gets unstuck can't checkpoint over whatever happened since).
+func (wd *watchdog) guard(fn func() error) error {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	if wd.abandoned {
+		return context.Canceled
+	}
+
+	return fn()
+}
+
+func (wd *watchdog) abandon() {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	wd.abandoned = true
+}
+
+// Run a copy until it finishes, the context is done, or it goes longer than
+// the idle timeout (zero means no limit) without reading anything. A copy
+// that is stuck in a blocking call is abandoned rather than waited on so that
+// a hung connection can't hold up the transfer forever.
+func watchCopy(ctx context.Context, idle time.Duration, copy func(ctx context.Context, wd *watchdog) (int, error)) (int, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	wd := new(watchdog)
+	wd.progress()
+
+	type result struct {
+		n   int
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		n, err := copy(ctx, wd)
+		done <- result{n, err}
+	}()
+
+	var tick <-chan time.Time
+	if idle > 0 {
+		ticker := time.NewTicker(min(max(idle/4, 10*time.Millisecond), time.Second))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case res := <-done:
+			// a copy that noticed it was stopped reports why it was stopped
+			if res.err != nil && ctx.Err() != nil {
+				return res.n, context.Cause(ctx)
+			}
+
+			return res.n, res.err
+		case <-tick:
+			if wd.idleFor() > idle {
+				cancel(ErrIdleTimeout)
+			}
+		case <-ctx.Done():
+			wd.abandon()
+
+			// the copy may have finished at the same time
+			select {
+			case res := <-done:
+				if res.err == nil {
+					return res.n, nil
+				}
+			default:
+			}
+
+			return 0, context.Cause(ctx)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package fileserver_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+// A source whose files never send any data (like a hung FTP data channel).
+type stalledFileServer struct {
+	fileserver.FileServer
+}
+
+func (fs *stalledFileServer) Read(name string) (io.Reader, error) {
+	// nothing is ever written so reads block until the pipe is closed
+	r, _ := io.Pipe()
+	return r, nil
+}
+
+func newStalledFileServer(t *testing.T, name string) *stalledFileServer {
+	t.Helper()
+
+	mem, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	err = mem.Write(fileserver.FileInfo{Name: name}, bytes.NewReader(nil))
+	test.AssertNilError(t, err)
+
+	return &stalledFileServer{mem}
+}
+
+func TestTransferIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	from := newStalledFileServer(t, "stuck.csv")
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	opts := fileserver.TransferOptions{
+		IdleTimeout: 50 * time.Millisecond,
+		Retry:       fileserver.RetryPolicy{MaxAttempts: 3},
+	}
+	_, err = fileserver.Transfer(context.Background(), "*", from, to, opts)
+	test.AssertErrorIs(t, err, fileserver.ErrIdleTimeout)
+
+	// the error points out which file got stuck
+	var fileErr *fileserver.FileError
+	test.AssertEqual(t, errors.As(err, &fileErr), true)
+	test.AssertEqual(t, fileErr.Name, "stuck.csv")
+}
+
+func TestTransferDeadline(t *testing.T) {
+	t.Parallel()
+
+	from := newStalledFileServer(t, "stuck.csv")
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	// stuck copies are abandoned as soon as the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = fileserver.Transfer(ctx, "*", from, to, fileserver.TransferOptions{})
+	test.AssertErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -1,8 +1,83 @@
 package fileserver
 
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Options that control how files are copied between FileServers.
+type TransferOptions struct {
+	// What to do when a file already exists at the destination.
+	Conflict ConflictPolicy
+
+	// Only transfer matching files with these names (nil means all of them).
+	Files []string
+
+	// Marker files that gate data files (and signal their delivery).
+	Marker MarkerPolicy
+
+	// Source files that were already handled by a previous run.
+	Completed map[string]bool
+
+	// Partially-copied file left behind by a previous run (if any).
+	Partial *Partial
+
+	// How to retry files that fail with a transient error (separate from how
+	// the transfer as a whole gets rescheduled).
+	Retry RetryPolicy
+
+	// Token buckets that bound the throughput of each copy (nil is unlimited).
+	Limiters []*rate.Limiter
+
+	// Abort a file's copy once it goes this long without reading anything
+	// (zero means no limit).
+	IdleTimeout time.Duration
+
+	// Files at least this large are copied in resumable parts when both
+	// FileServers support it (zero uses DefaultResumeThreshold).
+	ResumeThreshold int
+
+	// Called before each file is handled.
+	OnStart func(name string) error
+
+	// Called once each file has been handled (copied, skipped, etc).
+	OnResult func(result TransferResult) error
+
+	// Called when a file couldn't be handled (before the transfer stops).
+	OnFailure func(result TransferResult, err error) error
+
+	// Called each time a resumable copy commits more of a file.
+	OnPartial func(partial Partial) error
+}
+
+// The outcome of transferring a single file.
+type TransferResult struct {
+	Name   string
+	Dest   string
+	Size   int
+	Action Action
+
+	// Hex-encoded SHA-256 of the copied file (empty if it wasn't copied in
+	// one piece by a single run).
+	Checksum string
+	// Number of times the copy was attempted (zero if it was skipped).
+	Attempts int
+
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
 // Transfer all files matching a given pattern from one FileServer to another.
 // Returns the total number of bytes transferred or an error.
-func Transfer(pattern string, from, to FileServer) (int, error) {
+func Transfer(ctx context.Context, pattern string, from, to FileServer, opts TransferOptions) (int, error) {
+	from, to = withContext(ctx, from), withContext(ctx, to)
+
 	files, err := from.Search(pattern)
 	if err != nil {
 		return 0, err
@@ -11,19 +86,280 @@ func Transfer(pattern string, from, to FileServer) (int, error) {
 	// TODO: spawn a goro and return a progress channel
 
 	var totalBytes int
+	var handled int
 	for _, file := range files {
-		r, err := from.Read(file.Name)
+		// stop at the next file boundary once canceled
+		err = ctx.Err()
 		if err != nil {
 			return 0, err
 		}
 
-		err = to.Write(file, r)
+		// skip anything that wasn't asked for (and markers themselves)
+		if !opts.wants(file.Name) {
+			continue
+		}
+
+		// skip anything that a previous run already took care of
+		if opts.Completed[file.Name] {
+			handled++
+			continue
+		}
+
+		// skip data files whose marker hasn't shown up yet
+		ready, err := opts.Marker.ready(from, file.Name)
 		if err != nil {
 			return 0, err
 		}
+		if !ready {
+			continue
+		}
 
-		totalBytes += file.Size
+		var partial *Partial
+		if opts.Partial != nil && opts.Partial.Name == file.Name {
+			partial = opts.Partial
+		}
+
+		if opts.OnStart != nil {
+			err = opts.OnStart(file.Name)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		// start from the size the source reports (so failures have one too)
+		result := TransferResult{
+			Name:      file.Name,
+			Size:      file.Size,
+			StartedAt: time.Now(),
+		}
+
+		// let the caller know which file failed (and how) before giving up
+		fail := func(err error) error {
+			fileErr := &FileError{Name: file.Name, Err: err}
+			if opts.OnFailure != nil {
+				result.FinishedAt = time.Now()
+				failErr := opts.OnFailure(result, err)
+				if failErr != nil {
+					return errors.Join(fileErr, failErr)
+				}
+			}
+			return fileErr
+		}
+
+		// evaluate the conflict policy against the destination (per file)
+		var dest string
+		var action Action
+		if partial != nil {
+			// a partial copy already decided where this file is going
+			dest, action = partial.Dest, partial.Action
+		} else {
+			dest, action, err = resolveConflict(to, file, opts.Conflict)
+			if err != nil {
+				return 0, fail(err)
+			}
+		}
+
+		result.Dest = dest
+		result.Action = action
+
+		if action != ActionSkip {
+			// keep track of the latest checkpoint so retries can resume from it
+			commit := func(p Partial) error {
+				partial = &p
+				if opts.OnPartial == nil {
+					return nil
+				}
+				return opts.OnPartial(p)
+			}
+
+			var n int
+			var d *digest
+			err = retry(ctx, opts.Retry, func() error {
+				result.Attempts++
+
+				// each attempt starts a fresh checksum
+				attempt := newDigest()
+				d = attempt
+
+				var err error
+				n, err = watchCopy(ctx, opts.IdleTimeout, func(ctx context.Context, wd *watchdog) (int, error) {
+					return copyFile(ctx, wd, attempt, from, to, file, dest, action, partial, opts, commit)
+				})
+				return err
+			})
+			if err != nil {
+				return 0, fail(err)
+			}
+
+			result.Checksum = d.sum()
+
+			// record what was actually copied (sources may misreport sizes)
+			file.Size = n
+			totalBytes += n
+		}
+
+		// the file has been dealt with so its marker can be too
+		err = retry(ctx, opts.Retry, func() error {
+			return opts.Marker.handle(from, to, file.Name, dest)
+		})
+		if err != nil {
+			return 0, fail(err)
+		}
+		handled++
+
+		if opts.OnResult != nil {
+			result.Size = file.Size
+			result.FinishedAt = time.Now()
+			err = opts.OnResult(result)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// let the destination know that everything has landed
+	if handled > 0 {
+		err = retry(ctx, opts.Retry, func() error {
+			return opts.Marker.complete(to)
+		})
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	return totalBytes, nil
 }
+
+// Check whether a matching file should be considered at all: it must be one
+// of the files that were asked for (if any were) and not a marker.
+func (opts TransferOptions) wants(name string) bool {
+	if opts.Files != nil && !slices.Contains(opts.Files, name) {
+		return false
+	}
+
+	// markers are never transferred as data files
+	if opts.Marker.IsMarker(name) {
+		return false
+	}
+
+	return true
+}
+
+// The source's reported size didn't match what was actually read from it.
+var errSizeMismatch = errors.New("fileserver: source size mismatch")
+
+// Copy a file in a single write. Destinations are given the source's reported
+// size (which lets them skip buffering) so a mismatch is reported as
+// errSizeMismatch rather than risking a truncated copy.
+func writeStream(ctx context.Context, wd *watchdog, d *digest, from, to FileServer, name string, info FileInfo, limiters []*rate.Limiter) (int, error) {
+	r, err := from.Read(name)
+	if err != nil {
+		return 0, err
+	}
+	defer closeOnDone(ctx, r)()
+
+	cr := newCountingReader(newContextReader(ctx, newProgressReader(d.reader(r), wd.progress)))
+	err = to.Write(info, NewThrottledReader(ctx, cr, limiters...))
+
+	if info.Size != UnknownSize {
+		// the source ran out early (which the destination may have rejected)
+		if cr.eof && cr.n < info.Size {
+			return 0, errSizeMismatch
+		}
+
+		// the destination stopped at the reported size but there was more
+		if err == nil && !cr.eof {
+			extra, _ := cr.Read(make([]byte, 1))
+			if extra > 0 {
+				return 0, errSizeMismatch
+			}
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return cr.n, nil
+}
+
+// Copy a single file, in resumable parts if the file is large enough and both
+// FileServers support it. Returns the number of bytes copied.
+func copyFile(ctx context.Context, wd *watchdog, d *digest, from, to FileServer, file FileInfo, dest string, action Action, partial *Partial, opts TransferOptions, commit func(Partial) error) (int, error) {
+	// requests made by this attempt are abandoned along with it
+	from, to = withContext(ctx, from), withContext(ctx, to)
+
+	info := file
+	info.Name = dest
+
+	threshold := opts.ResumeThreshold
+	if threshold == 0 {
+		threshold = DefaultResumeThreshold
+	}
+
+	rr, canRange := from.(RangeReader)
+	rw, canResume := to.(ResumableWriter)
+	if !canRange || !canResume || file.Size < threshold {
+		n, err := writeStream(ctx, wd, d, from, to, file.Name, info, opts.Limiters)
+		if errors.Is(err, errSizeMismatch) {
+			// the reported size was wrong so stream the file without one
+			d.h.Reset()
+			info.Size = UnknownSize
+			n, err = writeStream(ctx, wd, d, from, to, file.Name, info, opts.Limiters)
+		}
+		return n, err
+	}
+
+	fresh := Partial{
+		Name:   file.Name,
+		Dest:   dest,
+		Action: action,
+	}
+
+	// resume from the last committed offset (if the source hasn't shrunk)
+	p := fresh
+	if partial != nil && partial.Offset <= file.Size {
+		p = *partial
+	}
+
+	// checkpoints from an abandoned copy are ignored
+	guarded := func(p Partial) error {
+		return wd.guard(func() error {
+			return commit(p)
+		})
+	}
+
+	n, err := writeResumable(ctx, wd, d, rr, rw, info, p, opts.Limiters, guarded)
+	if errors.Is(err, ErrUploadNotFound) && p.UploadID != "" {
+		// the previous upload is gone (expired or aborted) so start over
+		d.h.Reset()
+		n, err = writeResumable(ctx, wd, d, rr, rw, info, fresh, opts.Limiters, guarded)
+	}
+
+	return n, err
+}
+
+func writeResumable(ctx context.Context, wd *watchdog, d *digest, rr RangeReader, rw ResumableWriter, info FileInfo, p Partial, limiters []*rate.Limiter, commit func(Partial) error) (int, error) {
+	var r io.Reader = bytes.NewReader(nil)
+
+	// only read from the source if there is something left to read
+	if p.Offset < info.Size {
+		var err error
+		r, err = rr.ReadRange(p.Name, p.Offset)
+		if err != nil {
+			return 0, err
+		}
+	}
+	defer closeOnDone(ctx, r)()
+
+	// the start of the file was read by an earlier attempt (or run)
+	d.incomplete = p.Offset > 0
+
+	cr := newCountingReader(newContextReader(ctx, newProgressReader(d.reader(r), wd.progress)))
+	err := rw.WriteResumable(info, NewThrottledReader(ctx, cr, limiters...), p, commit)
+	if err != nil {
+		return 0, err
+	}
+
+	return p.Offset + cr.n, nil
+}
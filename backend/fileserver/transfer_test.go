@@ -2,8 +2,13 @@ package fileserver_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/theandrew168/dripfile/backend/fileserver"
 	"github.com/theandrew168/dripfile/backend/test"
@@ -42,7 +47,7 @@ func TestTransfer(t *testing.T) {
 	test.AssertNilError(t, err)
 
 	// run the transfer
-	totalBytes, err := fileserver.Transfer("*.txt", from, to)
+	totalBytes, err := fileserver.Transfer(context.Background(), "*.txt", from, to, fileserver.TransferOptions{})
 	test.AssertNilError(t, err)
 	test.AssertEqual(t, totalBytes, size)
 
@@ -63,3 +68,641 @@ func TestTransfer(t *testing.T) {
 	test.AssertNilError(t, err)
 	test.AssertEqual(t, string(buf), contents)
 }
+
+func TestTransferConflict(t *testing.T) {
+	t.Parallel()
+
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now()
+
+	tests := []struct {
+		policy     fileserver.ConflictPolicy
+		srcModTime time.Time
+		wantDest   string
+		wantAction fileserver.Action
+		wantData   string
+	}{
+		{fileserver.ConflictOverwrite, older, "foo.txt", fileserver.ActionOverwrite, "new"},
+		{fileserver.ConflictSkip, newer, "foo.txt", fileserver.ActionSkip, "old"},
+		{fileserver.ConflictOverwriteIfNewer, newer, "foo.txt", fileserver.ActionOverwrite, "new"},
+		{fileserver.ConflictOverwriteIfNewer, older, "foo.txt", fileserver.ActionSkip, "old"},
+		{fileserver.ConflictRenameNumeric, newer, "foo-1.txt", fileserver.ActionRename, "old"},
+	}
+
+	for _, tt := range tests {
+		from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+		test.AssertNilError(t, err)
+
+		to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+		test.AssertNilError(t, err)
+
+		err = from.Write(
+			fileserver.FileInfo{Name: "foo.txt", Size: 3, ModTime: tt.srcModTime},
+			bytes.NewBufferString("new"),
+		)
+		test.AssertNilError(t, err)
+
+		// the existing destination file is between the "older" and "newer" times
+		err = to.Write(
+			fileserver.FileInfo{Name: "foo.txt", Size: 3, ModTime: older.Add(time.Minute)},
+			bytes.NewBufferString("old"),
+		)
+		test.AssertNilError(t, err)
+
+		var results []fileserver.TransferResult
+		opts := fileserver.TransferOptions{
+			Conflict: tt.policy,
+			OnResult: func(result fileserver.TransferResult) error {
+				results = append(results, result)
+				return nil
+			},
+		}
+
+		_, err = fileserver.Transfer(context.Background(), "*", from, to, opts)
+		test.AssertNilError(t, err)
+
+		test.AssertEqual(t, len(results), 1)
+		test.AssertEqual(t, results[0].Dest, tt.wantDest)
+		test.AssertEqual(t, results[0].Action, tt.wantAction)
+
+		// the original destination file should hold the expected contents
+		r, err := to.Read("foo.txt")
+		test.AssertNilError(t, err)
+
+		buf, err := io.ReadAll(r)
+		test.AssertNilError(t, err)
+		test.AssertEqual(t, string(buf), tt.wantData)
+	}
+}
+
+func TestTransferConflictFail(t *testing.T) {
+	t.Parallel()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	info := fileserver.FileInfo{Name: "foo.txt", Size: 3}
+
+	err = from.Write(info, bytes.NewBufferString("new"))
+	test.AssertNilError(t, err)
+
+	err = to.Write(info, bytes.NewBufferString("old"))
+	test.AssertNilError(t, err)
+
+	opts := fileserver.TransferOptions{
+		Conflict: fileserver.ConflictFail,
+	}
+
+	_, err = fileserver.Transfer(context.Background(), "*", from, to, opts)
+	test.AssertErrorIs(t, err, fileserver.ErrExists)
+}
+
+func TestTransferConflictRenameTimestamp(t *testing.T) {
+	t.Parallel()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	info := fileserver.FileInfo{Name: "foo.txt", Size: 3}
+
+	err = from.Write(info, bytes.NewBufferString("new"))
+	test.AssertNilError(t, err)
+
+	err = to.Write(info, bytes.NewBufferString("old"))
+	test.AssertNilError(t, err)
+
+	opts := fileserver.TransferOptions{
+		Conflict: fileserver.ConflictRenameTimestamp,
+	}
+
+	_, err = fileserver.Transfer(context.Background(), "*", from, to, opts)
+	test.AssertNilError(t, err)
+
+	files, err := to.Search("foo-*.txt")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(files), 1)
+}
+
+func TestTransferCompleted(t *testing.T) {
+	t.Parallel()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		err = from.Write(
+			fileserver.FileInfo{Name: name, Size: 3},
+			bytes.NewBufferString("foo"),
+		)
+		test.AssertNilError(t, err)
+	}
+
+	// pretend that a previous run already copied "a.txt"
+	opts := fileserver.TransferOptions{
+		Completed: map[string]bool{"a.txt": true},
+	}
+
+	totalBytes, err := fileserver.Transfer(context.Background(), "*", from, to, opts)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, totalBytes, 3)
+
+	files, err := to.Search("*")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(files), 1)
+	test.AssertEqual(t, files[0].Name, "b.txt")
+}
+
+var errFlaky = errors.New("flaky connection")
+
+// Wraps a FileServer and fails ranged reads after a certain number of bytes
+// (up to a certain number of times).
+type flakyFileServer struct {
+	*fileserver.MemoryFileServer
+	failAfter int
+	failures  int
+}
+
+func (fs *flakyFileServer) ReadRange(name string, offset int) (io.Reader, error) {
+	r, err := fs.MemoryFileServer.ReadRange(name, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.failures <= 0 {
+		return r, nil
+	}
+	fs.failures--
+
+	return io.MultiReader(io.LimitReader(r, int64(fs.failAfter)), errReader{}), nil
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errFlaky
+}
+
+func TestTransferResume(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	src, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	size := 10 * 1024
+	contents := random.String(size)
+
+	err = src.Write(
+		fileserver.FileInfo{Name: "big.bin", Size: size},
+		bytes.NewBufferString(contents),
+	)
+	test.AssertNilError(t, err)
+
+	// first run dies part way through the file
+	var partial *fileserver.Partial
+	opts := fileserver.TransferOptions{
+		ResumeThreshold: 1,
+		OnPartial: func(p fileserver.Partial) error {
+			partial = &p
+			return nil
+		},
+	}
+
+	from := &flakyFileServer{MemoryFileServer: src, failAfter: 6 * 1024, failures: 1}
+	_, err = fileserver.Transfer(context.Background(), "*", from, to, opts)
+	test.AssertErrorIs(t, err, errFlaky)
+
+	// only whole parts should have been committed
+	test.AssertNotEqual(t, partial, nil)
+	test.AssertEqual(t, partial.Offset, 4*1024)
+
+	_, err = to.Stat("big.bin")
+	test.AssertErrorIs(t, err, fileserver.ErrNotFound)
+
+	// second run picks up from the checkpoint
+	opts.Partial = partial
+	_, err = fileserver.Transfer(context.Background(), "*", src, to, opts)
+	test.AssertNilError(t, err)
+
+	r, err := to.Read("big.bin")
+	test.AssertNilError(t, err)
+
+	buf, err := io.ReadAll(r)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, string(buf), contents)
+}
+
+func TestTransferRetry(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	src, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	size := 10 * 1024
+	contents := random.String(size)
+
+	err = src.Write(
+		fileserver.FileInfo{Name: "big.bin", Size: size},
+		bytes.NewBufferString(contents),
+	)
+	test.AssertNilError(t, err)
+
+	// the first couple attempts make a little progress before failing
+	from := &flakyFileServer{MemoryFileServer: src, failAfter: 5 * 1024, failures: 2}
+	opts := fileserver.TransferOptions{
+		ResumeThreshold: 1,
+		Retry: fileserver.RetryPolicy{
+			MaxAttempts:   3,
+			InitialDelay:  time.Millisecond,
+			BackoffFactor: 1,
+		},
+	}
+
+	_, err = fileserver.Transfer(context.Background(), "*", from, to, opts)
+	test.AssertNilError(t, err)
+
+	r, err := to.Read("big.bin")
+	test.AssertNilError(t, err)
+
+	buf, err := io.ReadAll(r)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, string(buf), contents)
+}
+
+func TestTransferResults(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	size := 20
+	contents := random.String(size)
+
+	err = from.Write(
+		fileserver.FileInfo{Name: "a.txt", Size: size},
+		bytes.NewBufferString(contents),
+	)
+	test.AssertNilError(t, err)
+
+	// this one already exists at the destination
+	err = from.Write(
+		fileserver.FileInfo{Name: "b.txt", Size: size},
+		bytes.NewBufferString(random.String(size)),
+	)
+	test.AssertNilError(t, err)
+
+	err = to.Write(
+		fileserver.FileInfo{Name: "b.txt", Size: size},
+		bytes.NewBufferString(random.String(size)),
+	)
+	test.AssertNilError(t, err)
+
+	results := make(map[string]fileserver.TransferResult)
+	var failed []string
+	opts := fileserver.TransferOptions{
+		Conflict: fileserver.ConflictFail,
+		Files:    []string{"a.txt", "b.txt"},
+		OnResult: func(result fileserver.TransferResult) error {
+			results[result.Name] = result
+			return nil
+		},
+		OnFailure: func(result fileserver.TransferResult, err error) error {
+			test.AssertErrorIs(t, err, fileserver.ErrExists)
+			test.AssertEqual(t, result.Size, size)
+			failed = append(failed, result.Name)
+			return nil
+		},
+	}
+
+	// files are searched in no particular order so run until both are done
+	for len(results)+len(failed) < 2 {
+		_, err = fileserver.Transfer(context.Background(), "*", from, to, opts)
+		if err != nil {
+			var fileErr *fileserver.FileError
+			test.AssertEqual(t, errors.As(err, &fileErr), true)
+			test.AssertEqual(t, fileErr.Name, "b.txt")
+
+			opts.Files = []string{"a.txt"}
+		}
+	}
+
+	test.AssertEqual(t, len(failed), 1)
+	test.AssertEqual(t, failed[0], "b.txt")
+
+	result, ok := results["a.txt"]
+	test.AssertEqual(t, ok, true)
+	test.AssertEqual(t, result.Attempts, 1)
+	test.AssertEqual(t, result.Size, size)
+	test.AssertEqual(t, result.FinishedAt.Before(result.StartedAt), false)
+
+	sum := sha256.Sum256([]byte(contents))
+	test.AssertEqual(t, result.Checksum, hex.EncodeToString(sum[:]))
+}
+
+func TestTransferRetryPermanent(t *testing.T) {
+	t.Parallel()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	info := fileserver.FileInfo{Name: "foo.txt", Size: 3}
+
+	err = from.Write(info, bytes.NewBufferString("new"))
+	test.AssertNilError(t, err)
+
+	err = to.Write(info, bytes.NewBufferString("old"))
+	test.AssertNilError(t, err)
+
+	// a conflict failure is permanent so this should fail without any delay
+	opts := fileserver.TransferOptions{
+		Conflict: fileserver.ConflictFail,
+		Retry: fileserver.RetryPolicy{
+			MaxAttempts:  5,
+			InitialDelay: time.Hour,
+		},
+	}
+
+	_, err = fileserver.Transfer(context.Background(), "*", from, to, opts)
+	test.AssertErrorIs(t, err, fileserver.ErrExists)
+}
+
+func TestTransferInaccurateSize(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	// the source claims the file is larger than it really is
+	size := 20
+	contents := random.String(size)
+
+	err = from.Write(
+		fileserver.FileInfo{Name: "foo.txt", Size: size},
+		bytes.NewBufferString(contents),
+	)
+	test.AssertNilError(t, err)
+
+	lying := &lyingFileServer{MemoryFileServer: from, extra: 100}
+
+	var results []fileserver.TransferResult
+	opts := fileserver.TransferOptions{
+		OnResult: func(result fileserver.TransferResult) error {
+			results = append(results, result)
+			return nil
+		},
+	}
+
+	totalBytes, err := fileserver.Transfer(context.Background(), "*", lying, to, opts)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, totalBytes, size)
+	test.AssertEqual(t, len(results), 1)
+	test.AssertEqual(t, results[0].Size, size)
+
+	file, err := to.Stat("foo.txt")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, file.Size, size)
+}
+
+// Wraps a FileServer and over-reports the size of every file.
+type lyingFileServer struct {
+	*fileserver.MemoryFileServer
+	extra int
+}
+
+func (fs *lyingFileServer) Search(pattern string) ([]fileserver.FileInfo, error) {
+	files, err := fs.MemoryFileServer.Search(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range files {
+		files[i].Size += fs.extra
+	}
+
+	return files, nil
+}
+
+func TestTransferSizeHint(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	tests := []struct {
+		name  string
+		extra int
+	}{
+		{"accurate", 0},
+		{"larger", 100},
+		{"smaller", -5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+			test.AssertNilError(t, err)
+
+			mem, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+			test.AssertNilError(t, err)
+
+			size := 20
+			contents := random.String(size)
+
+			err = from.Write(
+				fileserver.FileInfo{Name: "foo.txt", Size: size},
+				bytes.NewBufferString(contents),
+			)
+			test.AssertNilError(t, err)
+
+			lying := &lyingFileServer{MemoryFileServer: from, extra: tt.extra}
+			to := &strictFileServer{MemoryFileServer: mem}
+
+			totalBytes, err := fileserver.Transfer(context.Background(), "*", lying, to, fileserver.TransferOptions{})
+			test.AssertNilError(t, err)
+			test.AssertEqual(t, totalBytes, size)
+
+			// the source's size is passed along (and only dropped if it was wrong)
+			test.AssertEqual(t, to.sizes[0], size+tt.extra)
+			if tt.extra != 0 {
+				test.AssertEqual(t, to.sizes[1], fileserver.UnknownSize)
+			}
+
+			r, err := mem.Read("foo.txt")
+			test.AssertNilError(t, err)
+
+			got, err := io.ReadAll(r)
+			test.AssertNilError(t, err)
+			test.AssertEqual(t, string(got), contents)
+		})
+	}
+}
+
+// Wraps a FileServer and (like S3) reads exactly the given size of a write.
+type strictFileServer struct {
+	*fileserver.MemoryFileServer
+	sizes []int
+}
+
+func (fs *strictFileServer) Write(info fileserver.FileInfo, r io.Reader) error {
+	fs.sizes = append(fs.sizes, info.Size)
+	if info.Size == fileserver.UnknownSize {
+		return fs.MemoryFileServer.Write(info, r)
+	}
+
+	buf := make([]byte, info.Size)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return err
+	}
+
+	return fs.MemoryFileServer.Write(info, bytes.NewReader(buf))
+}
+
+func TestTransferCanceled(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	size := 20
+	err = from.Write(
+		fileserver.FileInfo{Name: "foo.txt", Size: size},
+		bytes.NewBufferString(random.String(size)),
+	)
+	test.AssertNilError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = fileserver.Transfer(ctx, "*", from, to, fileserver.TransferOptions{})
+	test.AssertErrorIs(t, err, context.Canceled)
+
+	_, err = to.Stat("foo.txt")
+	test.AssertErrorIs(t, err, fileserver.ErrNotFound)
+}
+
+func TestAbortPartial(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	src, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	size := 10 * 1024
+	contents := random.String(size)
+
+	err = src.Write(
+		fileserver.FileInfo{Name: "big.bin", Size: size},
+		bytes.NewBufferString(contents),
+	)
+	test.AssertNilError(t, err)
+
+	// leave a partial upload behind
+	var partial *fileserver.Partial
+	opts := fileserver.TransferOptions{
+		ResumeThreshold: 1,
+		OnPartial: func(p fileserver.Partial) error {
+			partial = &p
+			return nil
+		},
+	}
+
+	from := &flakyFileServer{MemoryFileServer: src, failAfter: 6 * 1024, failures: 1}
+	_, err = fileserver.Transfer(context.Background(), "*", from, to, opts)
+	test.AssertErrorIs(t, err, errFlaky)
+	test.AssertNotEqual(t, partial, nil)
+
+	err = fileserver.AbortPartial(to, *partial)
+	test.AssertNilError(t, err)
+
+	// aborting twice is harmless
+	err = fileserver.AbortPartial(to, *partial)
+	test.AssertNilError(t, err)
+
+	// resuming the aborted upload starts over from scratch
+	opts.Partial = partial
+	_, err = fileserver.Transfer(context.Background(), "*", src, to, opts)
+	test.AssertNilError(t, err)
+
+	r, err := to.Read("big.bin")
+	test.AssertNilError(t, err)
+
+	buf, err := io.ReadAll(r)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, string(buf), contents)
+}
+
+func TestTransferFiles(t *testing.T) {
+	t.Parallel()
+
+	random := test.NewRandom()
+
+	from, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	to, err := fileserver.NewMemory(fileserver.MemoryInfo{})
+	test.AssertNilError(t, err)
+
+	size := 20
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		err = from.Write(
+			fileserver.FileInfo{Name: name, Size: size},
+			bytes.NewBufferString(random.String(size)),
+		)
+		test.AssertNilError(t, err)
+	}
+
+	// only the requested files (that also match the pattern) are copied
+	opts := fileserver.TransferOptions{
+		Files: []string{"b.txt", "missing.txt"},
+	}
+	totalBytes, err := fileserver.Transfer(context.Background(), "*.txt", from, to, opts)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, totalBytes, size)
+
+	files, err := to.Search("*")
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(files), 1)
+	test.AssertEqual(t, files[0].Name, "b.txt")
+}
@@ -0,0 +1,186 @@
+package fileserver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watches the root of a local directory for new files and reports them once
+// they have stopped changing for the settle time. Scanners and other tools
+// tend to write files in several chunks so reacting to the first event would
+// transfer incomplete files.
+type LocalWatcher struct {
+	root   string
+	settle time.Duration
+}
+
+type pendingFile struct {
+	size      int
+	modTime   time.Time
+	changedAt time.Time
+}
+
+func NewLocalWatcher(info LocalInfo) (*LocalWatcher, error) {
+	if !filepath.IsAbs(info.Root) {
+		return nil, errors.New("fileserver: local root must be absolute")
+	}
+
+	settle := info.SettleTime
+	if settle <= 0 {
+		settle = DefaultSettleTime
+	}
+
+	w := LocalWatcher{
+		root:   filepath.Clean(info.Root),
+		settle: settle,
+	}
+	return &w, nil
+}
+
+// Watch the directory until the context is canceled, calling onSettled with
+// each batch of new files. Files already in the directory when the watch
+// starts are treated as new, as are any files within it if the directory is
+// removed and later recreated (and the watch re-established).
+func (w *LocalWatcher) Run(ctx context.Context, onSettled func(files []FileInfo)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	pending := make(map[string]pendingFile)
+
+	// an initial failure is fine: the directory might not exist yet
+	watching := watcher.Add(w.root) == nil
+	if watching {
+		// pick up anything written while nothing was watching
+		w.scan(pending)
+	}
+
+	// check pending files (and retry a lost watch) a few times per settle period
+	ticker := time.NewTicker(max(min(w.settle/4, time.Second), 10*time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			// the directory itself was removed or moved away
+			if filepath.Clean(event.Name) == w.root {
+				if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+					watcher.Remove(w.root)
+					watching = false
+				}
+				continue
+			}
+
+			name := filepath.Base(event.Name)
+			if strings.HasPrefix(name, localTempPrefix) {
+				continue
+			}
+
+			switch {
+			case event.Has(fsnotify.Create) || event.Has(fsnotify.Write):
+				file, ok := pending[name]
+				if !ok {
+					file.size = UnknownSize
+				}
+
+				file.changedAt = time.Now()
+				pending[name] = file
+			case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+				delete(pending, name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			// events were dropped so fall back to checking everything
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.scan(pending)
+			}
+		case now := <-ticker.C:
+			if !watching {
+				err := watcher.Add(w.root)
+				if err != nil {
+					continue
+				}
+
+				// pick up anything written before the watch was restored
+				watching = true
+				w.scan(pending)
+				continue
+			}
+
+			settled := w.settled(pending, now)
+			if len(settled) > 0 {
+				onSettled(settled)
+			}
+		}
+	}
+}
+
+// Treat every file in the directory as pending.
+func (w *LocalWatcher) scan(pending map[string]pendingFile) {
+	entries, err := os.ReadDir(w.root)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), localTempPrefix) {
+			continue
+		}
+
+		if _, ok := pending[entry.Name()]; ok {
+			continue
+		}
+
+		pending[entry.Name()] = pendingFile{
+			size:      UnknownSize,
+			changedAt: time.Now(),
+		}
+	}
+}
+
+// Remove and return the pending files that haven't changed for the settle time.
+func (w *LocalWatcher) settled(pending map[string]pendingFile, now time.Time) []FileInfo {
+	var settled []FileInfo
+	for name, file := range pending {
+		stat, err := os.Stat(filepath.Join(w.root, name))
+		if err != nil || !stat.Mode().IsRegular() {
+			delete(pending, name)
+			continue
+		}
+
+		info := localFileInfo(stat)
+		if info.Size != file.size || !info.ModTime.Equal(file.modTime) {
+			file.size = info.Size
+			file.modTime = info.ModTime
+			file.changedAt = now
+			pending[name] = file
+			continue
+		}
+
+		if now.Sub(file.changedAt) < w.settle {
+			continue
+		}
+
+		settled = append(settled, info)
+		delete(pending, name)
+	}
+
+	return settled
+}
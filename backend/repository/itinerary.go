@@ -9,6 +9,8 @@ import (
 
 	"github.com/theandrew168/dripfile/backend/database"
 	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/secret"
 )
 
 // ensure ItineraryRepository interface is satisfied
@@ -18,7 +20,12 @@ type ItineraryRepository interface {
 	Create(itinerary *domain.Itinerary) error
 	List() ([]*domain.Itinerary, error)
 	Read(id uuid.UUID) (*domain.Itinerary, error)
+	Update(itinerary *domain.Itinerary) error
 	Delete(itinerary *domain.Itinerary) error
+	AcquirePoll() (*domain.Itinerary, error)
+	ListUnseen(itinerary *domain.Itinerary, files []fileserver.FileInfo) ([]fileserver.FileInfo, error)
+	MarkSeen(itinerary *domain.Itinerary, files []fileserver.FileInfo) error
+	AddSeen(itinerary *domain.Itinerary, files []fileserver.FileInfo) error
 }
 
 type Itinerary struct {
@@ -28,17 +35,41 @@ type Itinerary struct {
 	FromLocationID uuid.UUID `db:"from_location_id"`
 	ToLocationID   uuid.UUID `db:"to_location_id"`
 
+	Conflict fileserver.ConflictPolicy `db:"conflict"`
+
+	RetryMaxAttempts   int           `db:"retry_max_attempts"`
+	RetryInitialDelay  time.Duration `db:"retry_initial_delay"`
+	RetryBackoffFactor float64       `db:"retry_backoff_factor"`
+	RetryJitter        float64       `db:"retry_jitter"`
+
+	MarkerSuffix   string                  `db:"marker_suffix"`
+	MarkerAction   fileserver.MarkerAction `db:"marker_action"`
+	MarkerComplete string                  `db:"marker_complete"`
+
+	MaxBytesPerSecond int `db:"max_bytes_per_second"`
+	Priority          int `db:"priority"`
+
+	MaxDuration time.Duration `db:"max_duration"`
+	IdleTimeout time.Duration `db:"idle_timeout"`
+
+	PollInterval time.Duration `db:"poll_interval"`
+	PolledAt     *time.Time    `db:"polled_at"`
+
+	TriggerSecret []byte `db:"trigger_secret"`
+
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
 }
 
 type PostgresItineraryRepository struct {
 	conn database.Conn
+	box  *secret.Box
 }
 
-func NewPostgresItineraryRepository(conn database.Conn) *PostgresItineraryRepository {
+func NewPostgresItineraryRepository(conn database.Conn, box *secret.Box) *PostgresItineraryRepository {
 	repo := PostgresItineraryRepository{
 		conn: conn,
+		box:  box,
 	}
 	return &repo
 }
@@ -51,18 +82,92 @@ func (repo *PostgresItineraryRepository) marshal(itinerary *domain.Itinerary) (I
 		FromLocationID: itinerary.FromLocationID(),
 		ToLocationID:   itinerary.ToLocationID(),
 
+		Conflict: itinerary.Conflict(),
+
+		RetryMaxAttempts:   itinerary.Retry().MaxAttempts,
+		RetryInitialDelay:  itinerary.Retry().InitialDelay,
+		RetryBackoffFactor: itinerary.Retry().BackoffFactor,
+		RetryJitter:        itinerary.Retry().Jitter,
+
+		MarkerSuffix:   itinerary.Marker().Suffix,
+		MarkerAction:   itinerary.Marker().Action,
+		MarkerComplete: itinerary.Marker().Complete,
+
+		MaxBytesPerSecond: itinerary.MaxBytesPerSecond(),
+		Priority:          itinerary.Priority(),
+
+		MaxDuration: itinerary.MaxDuration(),
+		IdleTimeout: itinerary.IdleTimeout(),
+
+		PollInterval: itinerary.PollInterval(),
+
 		CreatedAt: itinerary.CreatedAt(),
 		UpdatedAt: itinerary.UpdatedAt(),
 	}
+
+	// a zero time means that the source has never been polled
+	if !itinerary.PolledAt().IsZero() {
+		polledAt := itinerary.PolledAt()
+		row.PolledAt = &polledAt
+	}
+
+	// webhook trigger secrets are encrypted at rest (just like location info)
+	if itinerary.TriggerSecret() != "" {
+		encryptedTriggerSecret, err := repo.box.Encrypt([]byte(itinerary.TriggerSecret()))
+		if err != nil {
+			return Itinerary{}, err
+		}
+
+		row.TriggerSecret = encryptedTriggerSecret
+	}
+
 	return row, nil
 }
 
 func (repo *PostgresItineraryRepository) unmarshal(row Itinerary) (*domain.Itinerary, error) {
+	retry := fileserver.RetryPolicy{
+		MaxAttempts:   row.RetryMaxAttempts,
+		InitialDelay:  row.RetryInitialDelay,
+		BackoffFactor: row.RetryBackoffFactor,
+		Jitter:        row.RetryJitter,
+	}
+
+	marker := fileserver.MarkerPolicy{
+		Suffix:   row.MarkerSuffix,
+		Action:   row.MarkerAction,
+		Complete: row.MarkerComplete,
+	}
+
+	var polledAt time.Time
+	if row.PolledAt != nil {
+		polledAt = *row.PolledAt
+	}
+
+	var triggerSecret string
+	if row.TriggerSecret != nil {
+		decryptedTriggerSecret, err := repo.box.Decrypt(row.TriggerSecret)
+		if err != nil {
+			return nil, err
+		}
+
+		triggerSecret = string(decryptedTriggerSecret)
+	}
+
 	itinerary := domain.LoadItinerary(
 		row.ID,
 		row.FromLocationID,
 		row.ToLocationID,
 		row.Pattern,
+		row.Conflict,
+		retry,
+		marker,
+		row.MaxBytesPerSecond,
+		row.Priority,
+		row.MaxDuration,
+		row.IdleTimeout,
+		row.PollInterval,
+		polledAt,
+		triggerSecret,
 		row.CreatedAt,
 		row.UpdatedAt,
 	)
@@ -72,9 +177,14 @@ func (repo *PostgresItineraryRepository) unmarshal(row Itinerary) (*domain.Itine
 func (repo *PostgresItineraryRepository) Create(itinerary *domain.Itinerary) error {
 	stmt := `
 		INSERT INTO itinerary
-			(id, from_location_id, to_location_id, pattern, created_at, updated_at)
+			(id, from_location_id, to_location_id, pattern, conflict,
+			 retry_max_attempts, retry_initial_delay, retry_backoff_factor, retry_jitter,
+			 marker_suffix, marker_action, marker_complete,
+			 max_bytes_per_second, priority, max_duration, idle_timeout,
+			 poll_interval, polled_at, trigger_secret,
+			 created_at, updated_at)
 		VALUES
-			($1, $2, $3, $4, $5, $6)`
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)`
 
 	row, err := repo.marshal(itinerary)
 	if err != nil {
@@ -86,6 +196,21 @@ func (repo *PostgresItineraryRepository) Create(itinerary *domain.Itinerary) err
 		row.FromLocationID,
 		row.ToLocationID,
 		row.Pattern,
+		row.Conflict,
+		row.RetryMaxAttempts,
+		row.RetryInitialDelay,
+		row.RetryBackoffFactor,
+		row.RetryJitter,
+		row.MarkerSuffix,
+		row.MarkerAction,
+		row.MarkerComplete,
+		row.MaxBytesPerSecond,
+		row.Priority,
+		row.MaxDuration,
+		row.IdleTimeout,
+		row.PollInterval,
+		row.PolledAt,
+		row.TriggerSecret,
 		row.CreatedAt,
 		row.UpdatedAt,
 	}
@@ -108,6 +233,21 @@ func (repo *PostgresItineraryRepository) List() ([]*domain.Itinerary, error) {
 			from_location_id,
 			to_location_id,
 			pattern,
+			conflict,
+			retry_max_attempts,
+			retry_initial_delay,
+			retry_backoff_factor,
+			retry_jitter,
+			marker_suffix,
+			marker_action,
+			marker_complete,
+			max_bytes_per_second,
+			priority,
+			max_duration,
+			idle_timeout,
+			poll_interval,
+			polled_at,
+			trigger_secret,
 			created_at,
 			updated_at
 		FROM itinerary
@@ -146,6 +286,21 @@ func (repo *PostgresItineraryRepository) Read(id uuid.UUID) (*domain.Itinerary,
 			from_location_id,
 			to_location_id,
 			pattern,
+			conflict,
+			retry_max_attempts,
+			retry_initial_delay,
+			retry_backoff_factor,
+			retry_jitter,
+			marker_suffix,
+			marker_action,
+			marker_complete,
+			max_bytes_per_second,
+			priority,
+			max_duration,
+			idle_timeout,
+			poll_interval,
+			polled_at,
+			trigger_secret,
 			created_at,
 			updated_at
 		FROM itinerary
@@ -167,6 +322,73 @@ func (repo *PostgresItineraryRepository) Read(id uuid.UUID) (*domain.Itinerary,
 	return repo.unmarshal(row)
 }
 
+func (repo *PostgresItineraryRepository) Update(itinerary *domain.Itinerary) error {
+	now := time.Now()
+	stmt := `
+		UPDATE itinerary
+		SET
+			conflict = $1,
+			retry_max_attempts = $2,
+			retry_initial_delay = $3,
+			retry_backoff_factor = $4,
+			retry_jitter = $5,
+			marker_suffix = $6,
+			marker_action = $7,
+			marker_complete = $8,
+			max_bytes_per_second = $9,
+			priority = $10,
+			max_duration = $11,
+			idle_timeout = $12,
+			poll_interval = $13,
+			trigger_secret = $14,
+			updated_at = $15
+		WHERE id = $16
+		  AND updated_at = $17
+		RETURNING updated_at`
+
+	row, err := repo.marshal(itinerary)
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		row.Conflict,
+		row.RetryMaxAttempts,
+		row.RetryInitialDelay,
+		row.RetryBackoffFactor,
+		row.RetryJitter,
+		row.MarkerSuffix,
+		row.MarkerAction,
+		row.MarkerComplete,
+		row.MaxBytesPerSecond,
+		row.Priority,
+		row.MaxDuration,
+		row.IdleTimeout,
+		row.PollInterval,
+		row.TriggerSecret,
+		now,
+		row.ID,
+		row.UpdatedAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	// use the stored timestamp (postgres only keeps microseconds)
+	updatedAt, err := pgx.CollectOneRow(rows, pgx.RowTo[time.Time])
+	if err != nil {
+		return checkUpdateError(err)
+	}
+
+	itinerary.SetUpdatedAt(updatedAt)
+	return nil
+}
+
 func (repo *PostgresItineraryRepository) Delete(itinerary *domain.Itinerary) error {
 	stmt := `
 		DELETE FROM itinerary
@@ -193,3 +415,174 @@ func (repo *PostgresItineraryRepository) Delete(itinerary *domain.Itinerary) err
 
 	return nil
 }
+
+// Claim the next itinerary whose source location is due to be polled. Only one
+// process can claim a given poll since polled_at is bumped in the same update.
+func (repo *PostgresItineraryRepository) AcquirePoll() (*domain.Itinerary, error) {
+	stmt := `
+		UPDATE itinerary
+		SET polled_at = now()
+		WHERE id = (
+			SELECT id
+			FROM itinerary
+			WHERE poll_interval > '0'
+			  AND (polled_at IS NULL OR polled_at + poll_interval <= now())
+			ORDER BY polled_at ASC NULLS FIRST
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING
+			id,
+			from_location_id,
+			to_location_id,
+			pattern,
+			conflict,
+			retry_max_attempts,
+			retry_initial_delay,
+			retry_backoff_factor,
+			retry_jitter,
+			marker_suffix,
+			marker_action,
+			marker_complete,
+			max_bytes_per_second,
+			priority,
+			max_duration,
+			idle_timeout,
+			poll_interval,
+			polled_at,
+			trigger_secret,
+			created_at,
+			updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Itinerary])
+	if err != nil {
+		return nil, checkReadError(err)
+	}
+
+	return repo.unmarshal(row)
+}
+
+// Filter a list of files down to those that are new (or have changed) since
+// they were last marked as seen for a given itinerary.
+func (repo *PostgresItineraryRepository) ListUnseen(itinerary *domain.Itinerary, files []fileserver.FileInfo) ([]fileserver.FileInfo, error) {
+	stmt := `
+		SELECT file.name
+		FROM unnest($2::text[], $3::bigint[], $4::timestamptz[]) AS file (name, size, mod_time)
+		LEFT JOIN itinerary_seen_file AS seen
+			ON seen.itinerary_id = $1
+			AND seen.name = file.name
+		WHERE seen.name IS NULL
+		   OR seen.size <> file.size
+		   OR seen.mod_time <> file.mod_time`
+
+	names, sizes, modTimes := splitFiles(files)
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, itinerary.ID(), names, sizes, modTimes)
+	if err != nil {
+		return nil, err
+	}
+
+	unseenNames, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, checkListError(err)
+	}
+
+	unseen := make(map[string]bool)
+	for _, name := range unseenNames {
+		unseen[name] = true
+	}
+
+	var unseenFiles []fileserver.FileInfo
+	for _, file := range files {
+		if unseen[file.Name] {
+			unseenFiles = append(unseenFiles, file)
+		}
+	}
+
+	return unseenFiles, nil
+}
+
+// Replace the set of seen files for a given itinerary with the current listing
+// of its source location (forgetting files that have since disappeared).
+func (repo *PostgresItineraryRepository) MarkSeen(itinerary *domain.Itinerary, files []fileserver.FileInfo) error {
+	stmt := `
+		WITH file AS (
+			SELECT *
+			FROM unnest($2::text[], $3::bigint[], $4::timestamptz[]) AS file (name, size, mod_time)
+		), forgotten AS (
+			DELETE FROM itinerary_seen_file
+			WHERE itinerary_id = $1
+			  AND name NOT IN (SELECT name FROM file)
+		)
+		INSERT INTO itinerary_seen_file
+			(itinerary_id, name, size, mod_time)
+		SELECT $1, name, size, mod_time
+		FROM file
+		ON CONFLICT (itinerary_id, name) DO UPDATE
+		SET
+			size = EXCLUDED.size,
+			mod_time = EXCLUDED.mod_time`
+
+	names, sizes, modTimes := splitFiles(files)
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	_, err := repo.conn.Exec(ctx, stmt, itinerary.ID(), names, sizes, modTimes)
+	if err != nil {
+		return checkCreateError(err)
+	}
+
+	return nil
+}
+
+// Mark some files as seen for a given itinerary (leaving the rest of its seen
+// files as they are).
+func (repo *PostgresItineraryRepository) AddSeen(itinerary *domain.Itinerary, files []fileserver.FileInfo) error {
+	stmt := `
+		INSERT INTO itinerary_seen_file
+			(itinerary_id, name, size, mod_time)
+		SELECT $1, name, size, mod_time
+		FROM unnest($2::text[], $3::bigint[], $4::timestamptz[]) AS file (name, size, mod_time)
+		ON CONFLICT (itinerary_id, name) DO UPDATE
+		SET
+			size = EXCLUDED.size,
+			mod_time = EXCLUDED.mod_time`
+
+	names, sizes, modTimes := splitFiles(files)
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	_, err := repo.conn.Exec(ctx, stmt, itinerary.ID(), names, sizes, modTimes)
+	if err != nil {
+		return checkCreateError(err)
+	}
+
+	return nil
+}
+
+// Split files into parallel slices (for use with unnest).
+func splitFiles(files []fileserver.FileInfo) ([]string, []int64, []time.Time) {
+	names := make([]string, 0, len(files))
+	sizes := make([]int64, 0, len(files))
+	modTimes := make([]time.Time, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+		sizes = append(sizes, int64(file.Size))
+		modTimes = append(modTimes, file.ModTime)
+	}
+
+	return names, sizes, modTimes
+}
@@ -2,10 +2,12 @@ package repository_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
 	"github.com/theandrew168/dripfile/backend/repository"
 	"github.com/theandrew168/dripfile/backend/test"
 )
@@ -91,6 +93,18 @@ func TestItineraryRepositoryRead(t *testing.T) {
 	itinerary, err := domain.NewItinerary(from, to, "*")
 	test.AssertNilError(t, err)
 
+	err = itinerary.SetConflict(fileserver.ConflictRenameNumeric)
+	test.AssertNilError(t, err)
+
+	retry := fileserver.RetryPolicy{
+		MaxAttempts:   5,
+		InitialDelay:  time.Minute,
+		BackoffFactor: 1.5,
+		Jitter:        0.25,
+	}
+	err = itinerary.SetRetry(retry)
+	test.AssertNilError(t, err)
+
 	err = repo.Itinerary.Create(itinerary)
 	test.AssertNilError(t, err)
 
@@ -100,6 +114,8 @@ func TestItineraryRepositoryRead(t *testing.T) {
 	test.AssertEqual(t, got.Pattern(), itinerary.Pattern())
 	test.AssertEqual(t, got.FromLocationID(), itinerary.FromLocationID())
 	test.AssertEqual(t, got.ToLocationID(), itinerary.ToLocationID())
+	test.AssertEqual(t, got.Conflict(), fileserver.ConflictRenameNumeric)
+	test.AssertEqual(t, got.Retry(), retry)
 }
 
 func TestItineraryRepositoryReadNotFound(t *testing.T) {
@@ -145,3 +161,188 @@ func TestItineraryRepositoryDelete(t *testing.T) {
 	_, err = repo.Itinerary.Read(itinerary.ID())
 	test.AssertErrorIs(t, err, repository.ErrNotExist)
 }
+
+func TestItineraryRepositoryAcquirePoll(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(from)
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(to)
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	err = itinerary.SetPollInterval(time.Hour)
+	test.AssertNilError(t, err)
+
+	err = repo.Itinerary.Create(itinerary)
+	test.AssertNilError(t, err)
+
+	// other tests may be running so acquire until this one shows up
+	for {
+		acquired, err := repo.Itinerary.AcquirePoll()
+		test.AssertNilError(t, err)
+
+		if acquired.ID() == itinerary.ID() {
+			test.AssertEqual(t, acquired.PolledAt().IsZero(), false)
+			test.AssertEqual(t, acquired.PollDue(time.Now()), false)
+			break
+		}
+	}
+
+	// a freshly polled itinerary isn't due again until its interval passes
+	got, err := repo.Itinerary.Read(itinerary.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.PollInterval(), time.Hour)
+	test.AssertEqual(t, got.PolledAt().IsZero(), false)
+}
+
+func TestItineraryRepositorySeen(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(from)
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(to)
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	err = repo.Itinerary.Create(itinerary)
+	test.AssertNilError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	files := []fileserver.FileInfo{
+		{Name: "a.txt", Size: 10, ModTime: now},
+		{Name: "b.txt", Size: 20, ModTime: now},
+	}
+
+	// everything is new at first
+	unseen, err := repo.Itinerary.ListUnseen(itinerary, files)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(unseen), 2)
+
+	err = repo.Itinerary.MarkSeen(itinerary, files)
+	test.AssertNilError(t, err)
+
+	unseen, err = repo.Itinerary.ListUnseen(itinerary, files)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(unseen), 0)
+
+	// changed and added files are new again
+	files[1].Size = 25
+	files = append(files, fileserver.FileInfo{Name: "c.txt", Size: 30, ModTime: now})
+
+	unseen, err = repo.Itinerary.ListUnseen(itinerary, files)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(unseen), 2)
+	test.AssertEqual(t, unseen[0].Name, "b.txt")
+	test.AssertEqual(t, unseen[1].Name, "c.txt")
+
+	// adding seen files keeps the ones that were already there
+	err = repo.Itinerary.AddSeen(itinerary, files[2:])
+	test.AssertNilError(t, err)
+
+	unseen, err = repo.Itinerary.ListUnseen(itinerary, files)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(unseen), 1)
+	test.AssertEqual(t, unseen[0].Name, "b.txt")
+}
+
+func TestItineraryRepositoryUpdate(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	secret, err := itinerary.RotateTriggerSecret()
+	test.AssertNilError(t, err)
+
+	err = repo.Itinerary.Update(itinerary)
+	test.AssertNilError(t, err)
+
+	got, err := repo.Itinerary.Read(itinerary.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.TriggerSecret(), secret)
+
+	err = itinerary.DisableTrigger()
+	test.AssertNilError(t, err)
+
+	err = repo.Itinerary.Update(itinerary)
+	test.AssertNilError(t, err)
+
+	got, err = repo.Itinerary.Read(itinerary.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.TriggerSecret(), "")
+
+	// stale copies can't be updated
+	_, err = got.RotateTriggerSecret()
+	test.AssertNilError(t, err)
+
+	err = got.SetUpdatedAt(got.UpdatedAt().Add(-time.Second))
+	test.AssertNilError(t, err)
+
+	err = repo.Itinerary.Update(got)
+	test.AssertErrorIs(t, err, repository.ErrConflict)
+}
+
+func TestItineraryRepositoryMarker(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(from)
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(to)
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*.csv")
+	test.AssertNilError(t, err)
+
+	marker := fileserver.MarkerPolicy{
+		Suffix:   ".ok",
+		Action:   fileserver.MarkerActionCopy,
+		Complete: "_SUCCESS",
+	}
+
+	err = itinerary.SetMarker(marker)
+	test.AssertNilError(t, err)
+
+	err = repo.Itinerary.Create(itinerary)
+	test.AssertNilError(t, err)
+
+	got, err := repo.Itinerary.Read(itinerary.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.Marker(), marker)
+}
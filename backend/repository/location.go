@@ -33,6 +33,9 @@ type Location struct {
 	Info       []byte              `db:"info"`
 	PingStatus domain.PingStatus   `db:"ping_status"`
 
+	MaxBytesPerSecond int `db:"max_bytes_per_second"`
+	MaxActive         int `db:"max_active"`
+
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
 
@@ -71,6 +74,9 @@ func (repo *PostgresLocationRepository) marshal(location *domain.Location) (Loca
 		Info:       encryptedInfoJSON,
 		PingStatus: location.PingStatus(),
 
+		MaxBytesPerSecond: location.MaxBytesPerSecond(),
+		MaxActive:         location.MaxActive(),
+
 		CreatedAt: location.CreatedAt(),
 		UpdatedAt: location.UpdatedAt(),
 	}
@@ -83,6 +89,8 @@ func (repo *PostgresLocationRepository) unmarshal(row Location) (*domain.Locatio
 		return repo.unmarshalMemory(row)
 	case domain.LocationKindS3:
 		return repo.unmarshalS3(row)
+	case domain.LocationKindLocal:
+		return repo.unmarshalLocal(row)
 	}
 
 	return nil, fmt.Errorf("unknown location kind: %s", row.Kind)
@@ -100,7 +108,7 @@ func (repo *PostgresLocationRepository) unmarshalMemory(row Location) (*domain.L
 		return nil, err
 	}
 
-	location := domain.LoadMemoryLocation(row.ID, info, row.PingStatus, row.CreatedAt, row.UpdatedAt, row.UsedBy)
+	location := domain.LoadMemoryLocation(row.ID, info, row.PingStatus, row.MaxBytesPerSecond, row.MaxActive, row.CreatedAt, row.UpdatedAt, row.UsedBy)
 	return location, nil
 }
 
@@ -116,16 +124,32 @@ func (repo *PostgresLocationRepository) unmarshalS3(row Location) (*domain.Locat
 		return nil, err
 	}
 
-	location := domain.LoadS3Location(row.ID, info, row.PingStatus, row.CreatedAt, row.UpdatedAt, row.UsedBy)
+	location := domain.LoadS3Location(row.ID, info, row.PingStatus, row.MaxBytesPerSecond, row.MaxActive, row.CreatedAt, row.UpdatedAt, row.UsedBy)
+	return location, nil
+}
+
+func (repo *PostgresLocationRepository) unmarshalLocal(row Location) (*domain.Location, error) {
+	infoJSON, err := repo.box.Decrypt(row.Info)
+	if err != nil {
+		return nil, err
+	}
+
+	var info fileserver.LocalInfo
+	err = json.Unmarshal(infoJSON, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	location := domain.LoadLocalLocation(row.ID, info, row.PingStatus, row.MaxBytesPerSecond, row.MaxActive, row.CreatedAt, row.UpdatedAt, row.UsedBy)
 	return location, nil
 }
 
 func (repo *PostgresLocationRepository) Create(location *domain.Location) error {
 	stmt := `
 		INSERT INTO location
-			(id, kind, info, ping_status, created_at, updated_at)
+			(id, kind, info, ping_status, max_bytes_per_second, max_active, created_at, updated_at)
 		VALUES
-			($1, $2, $3, $4, $5, $6)`
+			($1, $2, $3, $4, $5, $6, $7, $8)`
 
 	row, err := repo.marshal(location)
 	if err != nil {
@@ -137,6 +161,8 @@ func (repo *PostgresLocationRepository) Create(location *domain.Location) error
 		row.Kind,
 		row.Info,
 		row.PingStatus,
+		row.MaxBytesPerSecond,
+		row.MaxActive,
 		row.CreatedAt,
 		row.UpdatedAt,
 	}
@@ -159,6 +185,8 @@ func (repo *PostgresLocationRepository) List() ([]*domain.Location, error) {
 			location.kind,
 			location.info,
 			location.ping_status,
+			location.max_bytes_per_second,
+			location.max_active,
 			location.created_at,
 			location.updated_at,
 			array_remove(array_agg(itinerary.id), NULL) AS used_by
@@ -202,6 +230,8 @@ func (repo *PostgresLocationRepository) Read(id uuid.UUID) (*domain.Location, er
 			location.kind,
 			location.info,
 			location.ping_status,
+			location.max_bytes_per_second,
+			location.max_active,
 			location.created_at,
 			location.updated_at,
 			array_remove(array_agg(itinerary.id), NULL) AS used_by
@@ -235,9 +265,11 @@ func (repo *PostgresLocationRepository) Update(location *domain.Location) error
 		SET
 			info = $1,
 			ping_status = $2,
-			updated_at = $3
-		WHERE id = $4
-		  AND updated_at = $5
+			max_bytes_per_second = $3,
+			max_active = $4,
+			updated_at = $5
+		WHERE id = $6
+		  AND updated_at = $7
 		RETURNING updated_at`
 
 	row, err := repo.marshal(location)
@@ -248,6 +280,8 @@ func (repo *PostgresLocationRepository) Update(location *domain.Location) error
 	args := []any{
 		row.Info,
 		row.PingStatus,
+		row.MaxBytesPerSecond,
+		row.MaxActive,
 		now,
 		row.ID,
 		row.UpdatedAt,
@@ -261,12 +295,13 @@ func (repo *PostgresLocationRepository) Update(location *domain.Location) error
 		return err
 	}
 
-	_, err = pgx.CollectOneRow(rows, pgx.RowTo[time.Time])
+	// use the stored timestamp (postgres only keeps microseconds)
+	updatedAt, err := pgx.CollectOneRow(rows, pgx.RowTo[time.Time])
 	if err != nil {
 		return checkUpdateError(err)
 	}
 
-	location.SetUpdatedAt(now)
+	location.SetUpdatedAt(updatedAt)
 	return err
 }
 
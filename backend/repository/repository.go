@@ -6,16 +6,22 @@ import (
 )
 
 type Repository struct {
-	Location  LocationRepository
-	Itinerary ItineraryRepository
-	Transfer  TransferRepository
+	Location      LocationRepository
+	Itinerary     ItineraryRepository
+	Transfer      TransferRepository
+	TransferFile  TransferFileRepository
+	TransferEvent TransferEventRepository
+	Schedule      ScheduleRepository
 }
 
 func NewPostgres(conn database.Conn, box *secret.Box) *Repository {
 	repo := Repository{
-		Location:  NewPostgresLocationRepository(conn, box),
-		Itinerary: NewPostgresItineraryRepository(conn),
-		Transfer:  NewPostgresTransferRepository(conn),
+		Location:      NewPostgresLocationRepository(conn, box),
+		Itinerary:     NewPostgresItineraryRepository(conn, box),
+		Transfer:      NewPostgresTransferRepository(conn),
+		TransferFile:  NewPostgresTransferFileRepository(conn),
+		TransferEvent: NewPostgresTransferEventRepository(conn),
+		Schedule:      NewPostgresScheduleRepository(conn),
 	}
 	return &repo
 }
@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/theandrew168/dripfile/backend/database"
+	"github.com/theandrew168/dripfile/backend/domain"
+)
+
+// ensure ScheduleRepository interface is satisfied
+var _ ScheduleRepository = (*PostgresScheduleRepository)(nil)
+
+type ScheduleRepository interface {
+	Create(schedule *domain.Schedule) error
+	List() ([]*domain.Schedule, error)
+	ListDue(now time.Time) ([]*domain.Schedule, error)
+	Read(id uuid.UUID) (*domain.Schedule, error)
+	Update(schedule *domain.Schedule) error
+	Delete(schedule *domain.Schedule) error
+}
+
+type Schedule struct {
+	ID uuid.UUID `db:"id"`
+
+	Expr      string    `db:"expr"`
+	Timezone  string    `db:"timezone"`
+	NextRunAt time.Time `db:"next_run_at"`
+
+	ItineraryIDs []uuid.UUID `db:"itinerary_ids"`
+
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+type PostgresScheduleRepository struct {
+	conn database.Conn
+}
+
+func NewPostgresScheduleRepository(conn database.Conn) *PostgresScheduleRepository {
+	repo := PostgresScheduleRepository{
+		conn: conn,
+	}
+	return &repo
+}
+
+func (repo *PostgresScheduleRepository) marshal(schedule *domain.Schedule) (Schedule, error) {
+	row := Schedule{
+		ID: schedule.ID(),
+
+		Expr:      schedule.Expr(),
+		Timezone:  schedule.Timezone(),
+		NextRunAt: schedule.NextRunAt(),
+
+		ItineraryIDs: schedule.ItineraryIDs(),
+
+		CreatedAt: schedule.CreatedAt(),
+		UpdatedAt: schedule.UpdatedAt(),
+	}
+	return row, nil
+}
+
+func (repo *PostgresScheduleRepository) unmarshal(row Schedule) (*domain.Schedule, error) {
+	schedule := domain.LoadSchedule(
+		row.ID,
+		row.Expr,
+		row.Timezone,
+		row.NextRunAt,
+		row.ItineraryIDs,
+		row.CreatedAt,
+		row.UpdatedAt,
+	)
+	return schedule, nil
+}
+
+func (repo *PostgresScheduleRepository) Create(schedule *domain.Schedule) error {
+	// insert the schedule and its itinerary links in a single statement
+	stmt := `
+		WITH schedule AS (
+			INSERT INTO schedule
+				(id, expr, timezone, next_run_at, created_at, updated_at)
+			VALUES
+				($1, $2, $3, $4, $5, $6)
+			RETURNING id
+		)
+		INSERT INTO schedule_itinerary
+			(schedule_id, itinerary_id)
+		SELECT schedule.id, unnest($7::uuid[])
+		FROM schedule`
+
+	row, err := repo.marshal(schedule)
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		row.ID,
+		row.Expr,
+		row.Timezone,
+		row.NextRunAt,
+		row.CreatedAt,
+		row.UpdatedAt,
+		row.ItineraryIDs,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	_, err = repo.conn.Exec(ctx, stmt, args...)
+	if err != nil {
+		return checkCreateError(err)
+	}
+
+	return nil
+}
+
+func (repo *PostgresScheduleRepository) List() ([]*domain.Schedule, error) {
+	stmt := `
+		SELECT
+			schedule.id,
+			schedule.expr,
+			schedule.timezone,
+			schedule.next_run_at,
+			schedule.created_at,
+			schedule.updated_at,
+			array_remove(array_agg(schedule_itinerary.itinerary_id), NULL) AS itinerary_ids
+		FROM schedule
+		LEFT JOIN schedule_itinerary
+			ON schedule_itinerary.schedule_id = schedule.id
+		GROUP BY schedule.id
+		ORDER BY schedule.created_at DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.collect(rows)
+}
+
+// List all schedules with a tick that is due as of a given time.
+func (repo *PostgresScheduleRepository) ListDue(now time.Time) ([]*domain.Schedule, error) {
+	stmt := `
+		SELECT
+			schedule.id,
+			schedule.expr,
+			schedule.timezone,
+			schedule.next_run_at,
+			schedule.created_at,
+			schedule.updated_at,
+			array_remove(array_agg(schedule_itinerary.itinerary_id), NULL) AS itinerary_ids
+		FROM schedule
+		LEFT JOIN schedule_itinerary
+			ON schedule_itinerary.schedule_id = schedule.id
+		WHERE schedule.next_run_at <= $1
+		GROUP BY schedule.id
+		ORDER BY schedule.next_run_at ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.collect(rows)
+}
+
+func (repo *PostgresScheduleRepository) collect(rows pgx.Rows) ([]*domain.Schedule, error) {
+	scheduleRows, err := pgx.CollectRows(rows, pgx.RowToStructByName[Schedule])
+	if err != nil {
+		return nil, checkListError(err)
+	}
+
+	var schedules []*domain.Schedule
+	for _, row := range scheduleRows {
+		schedule, err := repo.unmarshal(row)
+		if err != nil {
+			return nil, err
+		}
+
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+func (repo *PostgresScheduleRepository) Read(id uuid.UUID) (*domain.Schedule, error) {
+	stmt := `
+		SELECT
+			schedule.id,
+			schedule.expr,
+			schedule.timezone,
+			schedule.next_run_at,
+			schedule.created_at,
+			schedule.updated_at,
+			array_remove(array_agg(schedule_itinerary.itinerary_id), NULL) AS itinerary_ids
+		FROM schedule
+		LEFT JOIN schedule_itinerary
+			ON schedule_itinerary.schedule_id = schedule.id
+		WHERE schedule.id = $1
+		GROUP BY schedule.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Schedule])
+	if err != nil {
+		return nil, checkReadError(err)
+	}
+
+	return repo.unmarshal(row)
+}
+
+func (repo *PostgresScheduleRepository) Update(schedule *domain.Schedule) error {
+	now := time.Now()
+
+	// update the schedule and sync its itinerary links in a single statement
+	// (nothing changes if the schedule was modified concurrently)
+	stmt := `
+		WITH updated AS (
+			UPDATE schedule
+			SET
+				expr = $1,
+				timezone = $2,
+				next_run_at = $3,
+				updated_at = $4
+			WHERE id = $5
+			  AND updated_at = $6
+			RETURNING id, updated_at
+		), unlinked AS (
+			DELETE FROM schedule_itinerary
+			USING updated
+			WHERE schedule_itinerary.schedule_id = updated.id
+			  AND NOT (schedule_itinerary.itinerary_id = ANY($7::uuid[]))
+		), linked AS (
+			INSERT INTO schedule_itinerary
+				(schedule_id, itinerary_id)
+			SELECT updated.id, unnest($7::uuid[])
+			FROM updated
+			ON CONFLICT DO NOTHING
+		)
+		SELECT updated_at
+		FROM updated`
+
+	row, err := repo.marshal(schedule)
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		row.Expr,
+		row.Timezone,
+		row.NextRunAt,
+		now,
+		row.ID,
+		row.UpdatedAt,
+		row.ItineraryIDs,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	// use the stored timestamp (postgres only keeps microseconds)
+	updatedAt, err := pgx.CollectOneRow(rows, pgx.RowTo[time.Time])
+	if err != nil {
+		return checkUpdateError(err)
+	}
+
+	schedule.SetUpdatedAt(updatedAt)
+	return nil
+}
+
+func (repo *PostgresScheduleRepository) Delete(schedule *domain.Schedule) error {
+	stmt := `
+		DELETE FROM schedule
+		WHERE id = $1
+		RETURNING id`
+
+	err := schedule.CheckDelete()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, schedule.ID())
+	if err != nil {
+		return err
+	}
+
+	_, err = pgx.CollectOneRow(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return checkDeleteError(err)
+	}
+
+	return nil
+}
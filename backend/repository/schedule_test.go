@@ -0,0 +1,241 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/repository"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func createItinerary(t *testing.T, repo *repository.Repository) *domain.Itinerary {
+	t.Helper()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(from)
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(to)
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	err = repo.Itinerary.Create(itinerary)
+	test.AssertNilError(t, err)
+
+	return itinerary
+}
+
+func TestScheduleRepositoryCreate(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	schedule, err := domain.NewSchedule("@daily", "UTC")
+	test.AssertNilError(t, err)
+
+	err = schedule.Link(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Schedule.Create(schedule)
+	test.AssertNilError(t, err)
+}
+
+func TestScheduleRepositoryList(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	schedule, err := domain.NewSchedule("@daily", "UTC")
+	test.AssertNilError(t, err)
+
+	err = repo.Schedule.Create(schedule)
+	test.AssertNilError(t, err)
+
+	schedules, err := repo.Schedule.List()
+	test.AssertNilError(t, err)
+
+	var ids []uuid.UUID
+	for _, schedule := range schedules {
+		ids = append(ids, schedule.ID())
+	}
+
+	test.AssertSliceContains(t, ids, schedule.ID())
+}
+
+func TestScheduleRepositoryListDue(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	schedule, err := domain.NewSchedule("@hourly", "UTC")
+	test.AssertNilError(t, err)
+
+	err = repo.Schedule.Create(schedule)
+	test.AssertNilError(t, err)
+
+	var ids []uuid.UUID
+
+	// not due yet
+	schedules, err := repo.Schedule.ListDue(schedule.NextRunAt().Add(-time.Second))
+	test.AssertNilError(t, err)
+	for _, schedule := range schedules {
+		ids = append(ids, schedule.ID())
+	}
+	for _, id := range ids {
+		test.AssertNotEqual(t, id, schedule.ID())
+	}
+
+	// due once the tick arrives
+	schedules, err = repo.Schedule.ListDue(schedule.NextRunAt())
+	test.AssertNilError(t, err)
+
+	ids = nil
+	for _, schedule := range schedules {
+		ids = append(ids, schedule.ID())
+	}
+	test.AssertSliceContains(t, ids, schedule.ID())
+}
+
+func TestScheduleRepositoryRead(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	schedule, err := domain.NewSchedule("0 9 * * 1-5", "America/Chicago")
+	test.AssertNilError(t, err)
+
+	err = schedule.Link(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Schedule.Create(schedule)
+	test.AssertNilError(t, err)
+
+	got, err := repo.Schedule.Read(schedule.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.ID(), schedule.ID())
+	test.AssertEqual(t, got.Expr(), schedule.Expr())
+	test.AssertEqual(t, got.Timezone(), schedule.Timezone())
+	test.AssertEqual(t, got.NextRunAt().Equal(schedule.NextRunAt()), true)
+	test.AssertEqual(t, got.ItineraryIDs(), []uuid.UUID{itinerary.ID()})
+}
+
+func TestScheduleRepositoryReadNotFound(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	_, err := repo.Schedule.Read(uuid.New())
+	test.AssertErrorIs(t, err, repository.ErrNotExist)
+}
+
+func TestScheduleRepositoryUpdate(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	first := createItinerary(t, repo)
+	second := createItinerary(t, repo)
+
+	schedule, err := domain.NewSchedule("@hourly", "UTC")
+	test.AssertNilError(t, err)
+
+	err = schedule.Link(first)
+	test.AssertNilError(t, err)
+
+	err = repo.Schedule.Create(schedule)
+	test.AssertNilError(t, err)
+
+	schedule, err = repo.Schedule.Read(schedule.ID())
+	test.AssertNilError(t, err)
+
+	// advance the schedule and swap its linked itinerary
+	tick := schedule.NextRunAt()
+	err = schedule.Advance(tick)
+	test.AssertNilError(t, err)
+
+	err = schedule.Unlink(first)
+	test.AssertNilError(t, err)
+
+	err = schedule.Link(second)
+	test.AssertNilError(t, err)
+
+	err = repo.Schedule.Update(schedule)
+	test.AssertNilError(t, err)
+
+	got, err := repo.Schedule.Read(schedule.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.NextRunAt().Equal(tick.Add(time.Hour)), true)
+	test.AssertEqual(t, got.ItineraryIDs(), []uuid.UUID{second.ID()})
+}
+
+func TestScheduleRepositoryUpdateConflict(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	schedule, err := domain.NewSchedule("@hourly", "UTC")
+	test.AssertNilError(t, err)
+
+	err = repo.Schedule.Create(schedule)
+	test.AssertNilError(t, err)
+
+	// two schedulers read the same schedule
+	a, err := repo.Schedule.Read(schedule.ID())
+	test.AssertNilError(t, err)
+
+	b, err := repo.Schedule.Read(schedule.ID())
+	test.AssertNilError(t, err)
+
+	// only the first one gets to advance it
+	err = a.Advance(a.NextRunAt())
+	test.AssertNilError(t, err)
+
+	err = repo.Schedule.Update(a)
+	test.AssertNilError(t, err)
+
+	err = b.Advance(b.NextRunAt())
+	test.AssertNilError(t, err)
+
+	err = repo.Schedule.Update(b)
+	test.AssertErrorIs(t, err, repository.ErrConflict)
+}
+
+func TestScheduleRepositoryDelete(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	schedule, err := domain.NewSchedule("@daily", "UTC")
+	test.AssertNilError(t, err)
+
+	err = repo.Schedule.Create(schedule)
+	test.AssertNilError(t, err)
+
+	err = repo.Schedule.Delete(schedule)
+	test.AssertNilError(t, err)
+
+	_, err = repo.Schedule.Read(schedule.ID())
+	test.AssertErrorIs(t, err, repository.ErrNotExist)
+}
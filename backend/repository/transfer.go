@@ -9,6 +9,7 @@ import (
 
 	"github.com/theandrew168/dripfile/backend/database"
 	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
 )
 
 // ensure TransferRepository interface is satisfied
@@ -18,19 +19,41 @@ type TransferRepository interface {
 	Create(transfer *domain.Transfer) error
 	List() ([]*domain.Transfer, error)
 	Read(id uuid.UUID) (*domain.Transfer, error)
+	ReadByIdempotencyKey(key string) (*domain.Transfer, error)
+	ListReruns(transfer *domain.Transfer) ([]*domain.Transfer, error)
 	Update(transfer *domain.Transfer) error
+	Cancel(transfer *domain.Transfer) error
 	Delete(transfer *domain.Transfer) error
-	Acquire() (*domain.Transfer, error)
+	Acquire(lease time.Duration) (*domain.Transfer, error)
+	RenewLease(transfer *domain.Transfer, lease time.Duration) error
+	ReapExpired() ([]*domain.Transfer, error)
 }
 
 type Transfer struct {
 	ID uuid.UUID `db:"id"`
 
 	ItineraryID uuid.UUID             `db:"itinerary_id"`
+	ParentID    *uuid.UUID            `db:"parent_id"`
 	Status      domain.TransferStatus `db:"status"`
 	Progress    int                   `db:"progress"`
 	Error       string                `db:"error"`
 
+	Results []fileserver.TransferResult `db:"results"`
+	Partial *fileserver.Partial         `db:"partial"`
+
+	Priority  int        `db:"priority"`
+	NotBefore *time.Time `db:"not_before"`
+
+	Attempts      int        `db:"attempts"`
+	NextAttemptAt *time.Time `db:"next_attempt_at"`
+
+	IdempotencyKey *string  `db:"idempotency_key"`
+	Files          []string `db:"files"`
+
+	CancelRequestedAt *time.Time `db:"cancel_requested_at"`
+
+	StuckOn string `db:"stuck_on"`
+
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
 }
@@ -55,31 +78,130 @@ func (repo *PostgresTransferRepository) marshal(transfer *domain.Transfer) (Tran
 		Progress:    transfer.Progress(),
 		Error:       transfer.Error(),
 
+		Results: transfer.Results(),
+		Partial: transfer.Partial(),
+
+		Priority: transfer.Priority(),
+
+		Attempts: transfer.Attempts(),
+
+		Files: transfer.Files(),
+
+		StuckOn: transfer.StuckOn(),
+
 		CreatedAt: transfer.CreatedAt(),
 		UpdatedAt: transfer.UpdatedAt(),
 	}
+
+	// a nil ID means that the transfer isn't a rerun
+	if transfer.ParentID() != uuid.Nil {
+		parentID := transfer.ParentID()
+		row.ParentID = &parentID
+	}
+
+	// a zero time means that the transfer can start right away
+	if !transfer.NotBefore().IsZero() {
+		notBefore := transfer.NotBefore()
+		row.NotBefore = &notBefore
+	}
+
+	// a zero time means that no retry has been scheduled
+	if !transfer.NextAttemptAt().IsZero() {
+		nextAttemptAt := transfer.NextAttemptAt()
+		row.NextAttemptAt = &nextAttemptAt
+	}
+
+	// an empty key means that the transfer isn't deduplicated
+	if transfer.IdempotencyKey() != "" {
+		idempotencyKey := transfer.IdempotencyKey()
+		row.IdempotencyKey = &idempotencyKey
+	}
+
+	if transfer.CancelRequested() {
+		cancelRequestedAt := transfer.CancelRequestedAt()
+		row.CancelRequestedAt = &cancelRequestedAt
+	}
+
 	return row, nil
 }
 
 func (repo *PostgresTransferRepository) unmarshal(row Transfer) (*domain.Transfer, error) {
+	var parentID uuid.UUID
+	if row.ParentID != nil {
+		parentID = *row.ParentID
+	}
+
+	var notBefore time.Time
+	if row.NotBefore != nil {
+		notBefore = *row.NotBefore
+	}
+
+	var nextAttemptAt time.Time
+	if row.NextAttemptAt != nil {
+		nextAttemptAt = *row.NextAttemptAt
+	}
+
+	var idempotencyKey string
+	if row.IdempotencyKey != nil {
+		idempotencyKey = *row.IdempotencyKey
+	}
+
+	var cancelRequestedAt time.Time
+	if row.CancelRequestedAt != nil {
+		cancelRequestedAt = *row.CancelRequestedAt
+	}
+
 	transfer := domain.LoadTransfer(
 		row.ID,
 		row.ItineraryID,
+		parentID,
 		row.Status,
 		row.Progress,
 		row.Error,
+		row.Results,
+		row.Partial,
+		row.Priority,
+		notBefore,
+		row.Attempts,
+		nextAttemptAt,
+		idempotencyKey,
+		row.Files,
+		cancelRequestedAt,
+		row.StuckOn,
 		row.CreatedAt,
 		row.UpdatedAt,
 	)
 	return transfer, nil
 }
 
+// Channel that is notified (with the transfer's ID) whenever one is created.
+const TransferCreatedChannel = "transfer_created"
+
+// Channel that is notified (with a JSON summary of the transfer) whenever one
+// is created or its status or progress changes. This is sent by a trigger so
+// that every write is covered.
+const TransferUpdatedChannel = "transfer_updated"
+
+// Save a new transfer (starting its event timeline) and let any listening
+// workers know about it.
 func (repo *PostgresTransferRepository) Create(transfer *domain.Transfer) error {
 	stmt := `
-		INSERT INTO transfer
-			(id, itinerary_id, status, progress, error, created_at, updated_at)
-		VALUES
-			($1, $2, $3, $4, $5, $6, $7)`
+		WITH inserted AS (
+			INSERT INTO transfer
+				(id, itinerary_id, parent_id, status, progress, error, results, partial,
+				 priority, not_before, attempts, next_attempt_at, idempotency_key, files,
+				 cancel_requested_at, stuck_on, created_at, updated_at)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+			RETURNING id, created_at
+		), queued AS (
+			INSERT INTO transfer_event
+				(transfer_id, kind, worker_id, file, message, created_at)
+			SELECT id, $20, '', '', '', created_at
+			FROM inserted
+		)
+		SELECT pg_notify($19, id::text)
+		FROM inserted`
 
 	row, err := repo.marshal(transfer)
 	if err != nil {
@@ -89,11 +211,24 @@ func (repo *PostgresTransferRepository) Create(transfer *domain.Transfer) error
 	args := []any{
 		row.ID,
 		row.ItineraryID,
+		row.ParentID,
 		row.Status,
 		row.Progress,
 		row.Error,
+		row.Results,
+		row.Partial,
+		row.Priority,
+		row.NotBefore,
+		row.Attempts,
+		row.NextAttemptAt,
+		row.IdempotencyKey,
+		row.Files,
+		row.CancelRequestedAt,
+		row.StuckOn,
 		row.CreatedAt,
 		row.UpdatedAt,
+		TransferCreatedChannel,
+		domain.TransferEventQueued,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
@@ -112,9 +247,20 @@ func (repo *PostgresTransferRepository) List() ([]*domain.Transfer, error) {
 		SELECT
 			id,
 			itinerary_id,
+			parent_id,
 			status,
 			progress,
 			error,
+			results,
+			partial,
+			priority,
+			not_before,
+			attempts,
+			next_attempt_at,
+			idempotency_key,
+			files,
+			cancel_requested_at,
+			stuck_on,
 			created_at,
 			updated_at
 		FROM transfer
@@ -151,9 +297,20 @@ func (repo *PostgresTransferRepository) Read(id uuid.UUID) (*domain.Transfer, er
 		SELECT
 			id,
 			itinerary_id,
+			parent_id,
 			status,
 			progress,
 			error,
+			results,
+			partial,
+			priority,
+			not_before,
+			attempts,
+			next_attempt_at,
+			idempotency_key,
+			files,
+			cancel_requested_at,
+			stuck_on,
 			created_at,
 			updated_at
 		FROM transfer
@@ -175,6 +332,99 @@ func (repo *PostgresTransferRepository) Read(id uuid.UUID) (*domain.Transfer, er
 	return repo.unmarshal(row)
 }
 
+// Find the transfer that was enqueued with a given idempotency key.
+func (repo *PostgresTransferRepository) ReadByIdempotencyKey(key string) (*domain.Transfer, error) {
+	stmt := `
+		SELECT
+			id,
+			itinerary_id,
+			parent_id,
+			status,
+			progress,
+			error,
+			results,
+			partial,
+			priority,
+			not_before,
+			attempts,
+			next_attempt_at,
+			idempotency_key,
+			files,
+			cancel_requested_at,
+			stuck_on,
+			created_at,
+			updated_at
+		FROM transfer
+		WHERE idempotency_key = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, key)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Transfer])
+	if err != nil {
+		return nil, checkReadError(err)
+	}
+
+	return repo.unmarshal(row)
+}
+
+// List the transfers that reran or retried a given transfer (oldest first).
+func (repo *PostgresTransferRepository) ListReruns(transfer *domain.Transfer) ([]*domain.Transfer, error) {
+	stmt := `
+		SELECT
+			id,
+			itinerary_id,
+			parent_id,
+			status,
+			progress,
+			error,
+			results,
+			partial,
+			priority,
+			not_before,
+			attempts,
+			next_attempt_at,
+			idempotency_key,
+			files,
+			cancel_requested_at,
+			stuck_on,
+			created_at,
+			updated_at
+		FROM transfer
+		WHERE parent_id = $1
+		ORDER BY created_at ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, transfer.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	transferRows, err := pgx.CollectRows(rows, pgx.RowToStructByName[Transfer])
+	if err != nil {
+		return nil, checkListError(err)
+	}
+
+	var transfers []*domain.Transfer
+	for _, row := range transferRows {
+		transfer, err := repo.unmarshal(row)
+		if err != nil {
+			return nil, err
+		}
+
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, nil
+}
+
 func (repo *PostgresTransferRepository) Update(transfer *domain.Transfer) error {
 	now := time.Now()
 	stmt := `
@@ -183,9 +433,13 @@ func (repo *PostgresTransferRepository) Update(transfer *domain.Transfer) error
 			status = $1,
 			progress = $2,
 			error = $3,
-			updated_at = $4
-		WHERE id = $5
-		  AND updated_at = $6
+			results = $4,
+			partial = $5,
+			next_attempt_at = $6,
+			stuck_on = $7,
+			updated_at = $8
+		WHERE id = $9
+		  AND updated_at = $10
 		RETURNING updated_at`
 
 	row, err := repo.marshal(transfer)
@@ -197,6 +451,10 @@ func (repo *PostgresTransferRepository) Update(transfer *domain.Transfer) error
 		row.Status,
 		row.Progress,
 		row.Error,
+		row.Results,
+		row.Partial,
+		row.NextAttemptAt,
+		row.StuckOn,
 		now,
 		row.ID,
 		row.UpdatedAt,
@@ -210,15 +468,54 @@ func (repo *PostgresTransferRepository) Update(transfer *domain.Transfer) error
 		return err
 	}
 
-	_, err = pgx.CollectOneRow(rows, pgx.RowTo[time.Time])
+	// use the stored timestamp (postgres only keeps microseconds)
+	updatedAt, err := pgx.CollectOneRow(rows, pgx.RowTo[time.Time])
 	if err != nil {
 		return checkUpdateError(err)
 	}
 
-	transfer.SetUpdatedAt(now)
+	transfer.SetUpdatedAt(updatedAt)
 	return err
 }
 
+// Persist a cancellation request. This only touches the cancellation itself
+// (and not the rest of the transfer) so that it never conflicts with updates
+// from the worker that might be running the transfer.
+func (repo *PostgresTransferRepository) Cancel(transfer *domain.Transfer) error {
+	stmt := `
+		UPDATE transfer
+		SET
+			status = CASE WHEN status = 'running' THEN status ELSE 'canceled' END,
+			cancel_requested_at = coalesce(cancel_requested_at, $1),
+			updated_at = CASE WHEN status = 'running' THEN updated_at ELSE $2 END
+		WHERE id = $3
+		  AND status IN ('pending', 'running', 'retrying')
+		RETURNING status, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, transfer.CancelRequestedAt(), time.Now(), transfer.ID())
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		Status    domain.TransferStatus `db:"status"`
+		UpdatedAt time.Time             `db:"updated_at"`
+	}
+
+	// no rows means the transfer finished in the meantime
+	row, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[result])
+	if err != nil {
+		return checkUpdateError(err)
+	}
+
+	transfer.SetStatus(row.Status)
+	transfer.SetUpdatedAt(row.UpdatedAt)
+	return nil
+}
+
 func (repo *PostgresTransferRepository) Delete(transfer *domain.Transfer) error {
 	stmt := `
 		DELETE FROM transfer
@@ -246,31 +543,96 @@ func (repo *PostgresTransferRepository) Delete(transfer *domain.Transfer) error
 	return nil
 }
 
-func (repo *PostgresTransferRepository) Acquire() (*domain.Transfer, error) {
+// Key of the advisory lock that serializes acquisitions across all workers.
+const transferAcquireLock = 7264810391
+
+// Claim the next transfer that is ready to run. The claim is only held for
+// the length of the lease so it must be renewed until the transfer is done.
+// Higher priority transfers are claimed first (then older ones) and those
+// that may not start yet are skipped. Transfers whose source or destination
+// location is already busy with as many transfers as it allows are skipped
+// until one of those finishes.
+func (repo *PostgresTransferRepository) Acquire(lease time.Duration) (*domain.Transfer, error) {
+	// counting running transfers is only accurate if no other worker can
+	// claim one at the same time (so acquisitions take turns)
+	lockStmt := `
+		SELECT pg_advisory_xact_lock($1)`
+
 	stmt := `
+		WITH active AS (
+			SELECT location.id, count(running.id) AS count
+			FROM location
+			JOIN itinerary
+				ON itinerary.from_location_id = location.id
+				OR itinerary.to_location_id = location.id
+			JOIN transfer running
+				ON running.itinerary_id = itinerary.id
+				AND running.status = 'running'
+			WHERE location.max_active > 0
+			GROUP BY location.id
+		)
 		UPDATE transfer
-		SET status = 'running'
+		SET
+			status = 'running',
+			attempts = attempts + 1,
+			lease_expires_at = now() + $1 * interval '1 second'
 		WHERE id = (
-			SELECT id
+			SELECT transfer.id
 			FROM transfer
-			WHERE status = 'pending'
-			ORDER BY created_at ASC
-			FOR UPDATE SKIP LOCKED
+			JOIN itinerary
+				ON itinerary.id = transfer.itinerary_id
+			JOIN location from_location
+				ON from_location.id = itinerary.from_location_id
+			JOIN location to_location
+				ON to_location.id = itinerary.to_location_id
+			LEFT JOIN active from_active
+				ON from_active.id = from_location.id
+			LEFT JOIN active to_active
+				ON to_active.id = to_location.id
+			WHERE (transfer.status = 'pending'
+			   OR (transfer.status = 'retrying' AND transfer.next_attempt_at <= now()))
+			  AND (transfer.not_before IS NULL OR transfer.not_before <= now())
+			  AND (from_location.max_active = 0 OR coalesce(from_active.count, 0) < from_location.max_active)
+			  AND (to_location.max_active = 0 OR coalesce(to_active.count, 0) < to_location.max_active)
+			ORDER BY transfer.priority DESC, transfer.created_at ASC
+			FOR UPDATE OF transfer SKIP LOCKED
 			LIMIT 1
 		)
 		RETURNING
 			id,
 			itinerary_id,
+			parent_id,
 			status,
 			progress,
 			error,
+			results,
+			partial,
+			priority,
+			not_before,
+			attempts,
+			next_attempt_at,
+			idempotency_key,
+			files,
+			cancel_requested_at,
+			stuck_on,
 			created_at,
 			updated_at`
 
 	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
 	defer cancel()
 
-	rows, err := repo.conn.Query(ctx, stmt)
+	tx, err := repo.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, lockStmt, transferAcquireLock)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, stmt, lease.Seconds())
 	if err != nil {
 		return nil, err
 	}
@@ -280,5 +642,108 @@ func (repo *PostgresTransferRepository) Acquire() (*domain.Transfer, error) {
 		return nil, checkReadError(err)
 	}
 
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	return repo.unmarshal(row)
 }
+
+// Extend the lease on a running transfer. This doesn't touch updated_at so
+// that it never conflicts with the worker's own updates. The lease is only
+// renewed for the attempt that the worker acquired. ErrConflict means that
+// the transfer is no longer running that attempt (its lease was probably
+// reaped and the transfer may have been picked up by another worker).
+func (repo *PostgresTransferRepository) RenewLease(transfer *domain.Transfer, lease time.Duration) error {
+	stmt := `
+		UPDATE transfer
+		SET lease_expires_at = now() + $1 * interval '1 second'
+		WHERE id = $2
+		  AND status = 'running'
+		  AND attempts = $3
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, lease.Seconds(), transfer.ID(), transfer.Attempts())
+	if err != nil {
+		return err
+	}
+
+	_, err = pgx.CollectOneRow(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return checkUpdateError(err)
+	}
+
+	return nil
+}
+
+// Recover running transfers whose worker stopped renewing their lease (most
+// likely because it crashed). Each one goes back to pending unless it has
+// used up its itinerary's attempts (or was asked to stop).
+func (repo *PostgresTransferRepository) ReapExpired() ([]*domain.Transfer, error) {
+	stmt := `
+		UPDATE transfer t
+		SET
+			status = CASE
+				WHEN t.cancel_requested_at IS NOT NULL THEN 'canceled'
+				WHEN t.attempts >= i.retry_max_attempts THEN 'failure'
+				ELSE 'pending'
+			END,
+			error = CASE
+				WHEN t.cancel_requested_at IS NOT NULL THEN ''
+				ELSE $1
+			END,
+			lease_expires_at = NULL,
+			updated_at = $2
+		FROM itinerary i
+		WHERE i.id = t.itinerary_id
+		  AND t.status = 'running'
+		  AND t.lease_expires_at < now()
+		RETURNING
+			t.id,
+			t.itinerary_id,
+			t.parent_id,
+			t.status,
+			t.progress,
+			t.error,
+			t.results,
+			t.partial,
+			t.priority,
+			t.not_before,
+			t.attempts,
+			t.next_attempt_at,
+			t.idempotency_key,
+			t.files,
+			t.cancel_requested_at,
+			t.stuck_on,
+			t.created_at,
+			t.updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, "worker stopped responding", time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	transferRows, err := pgx.CollectRows(rows, pgx.RowToStructByName[Transfer])
+	if err != nil {
+		return nil, checkListError(err)
+	}
+
+	var transfers []*domain.Transfer
+	for _, row := range transferRows {
+		transfer, err := repo.unmarshal(row)
+		if err != nil {
+			return nil, err
+		}
+
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, nil
+}
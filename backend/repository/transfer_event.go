@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/theandrew168/dripfile/backend/database"
+	"github.com/theandrew168/dripfile/backend/domain"
+)
+
+// ensure TransferEventRepository interface is satisfied
+var _ TransferEventRepository = (*PostgresTransferEventRepository)(nil)
+
+type TransferEventRepository interface {
+	Create(event *domain.TransferEvent) error
+	List(transfer *domain.Transfer, limit, offset int) ([]*domain.TransferEvent, int, error)
+}
+
+type TransferEvent struct {
+	ID uuid.UUID `db:"id"`
+
+	TransferID uuid.UUID                `db:"transfer_id"`
+	Kind       domain.TransferEventKind `db:"kind"`
+	WorkerID   string                   `db:"worker_id"`
+	File       string                   `db:"file"`
+	Message    string                   `db:"message"`
+
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type PostgresTransferEventRepository struct {
+	conn database.Conn
+}
+
+func NewPostgresTransferEventRepository(conn database.Conn) *PostgresTransferEventRepository {
+	repo := PostgresTransferEventRepository{
+		conn: conn,
+	}
+	return &repo
+}
+
+func (repo *PostgresTransferEventRepository) marshal(event *domain.TransferEvent) (TransferEvent, error) {
+	row := TransferEvent{
+		ID: event.ID(),
+
+		TransferID: event.TransferID(),
+		Kind:       event.Kind(),
+		WorkerID:   event.WorkerID(),
+		File:       event.File(),
+		Message:    event.Message(),
+
+		CreatedAt: event.CreatedAt(),
+	}
+	return row, nil
+}
+
+func (repo *PostgresTransferEventRepository) unmarshal(row TransferEvent) (*domain.TransferEvent, error) {
+	event := domain.LoadTransferEvent(
+		row.ID,
+		row.TransferID,
+		row.Kind,
+		row.WorkerID,
+		row.File,
+		row.Message,
+		row.CreatedAt,
+	)
+	return event, nil
+}
+
+func (repo *PostgresTransferEventRepository) Create(event *domain.TransferEvent) error {
+	stmt := `
+		INSERT INTO transfer_event
+			(id, transfer_id, kind, worker_id, file, message, created_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7)`
+
+	row, err := repo.marshal(event)
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		row.ID,
+		row.TransferID,
+		row.Kind,
+		row.WorkerID,
+		row.File,
+		row.Message,
+		row.CreatedAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	_, err = repo.conn.Exec(ctx, stmt, args...)
+	if err != nil {
+		return checkCreateError(err)
+	}
+
+	return nil
+}
+
+// List a page of a transfer's events (oldest first) along with the total
+// number of events that it has.
+func (repo *PostgresTransferEventRepository) List(transfer *domain.Transfer, limit, offset int) ([]*domain.TransferEvent, int, error) {
+	stmt := `
+		SELECT
+			count(*) OVER() AS total,
+			id,
+			transfer_id,
+			kind,
+			worker_id,
+			file,
+			message,
+			created_at
+		FROM transfer_event
+		WHERE transfer_id = $1
+		ORDER BY created_at ASC
+		LIMIT $2 OFFSET $3`
+
+	type transferEventRow struct {
+		TransferEvent
+		Total int `db:"total"`
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, transfer.ID(), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	eventRows, err := pgx.CollectRows(rows, pgx.RowToStructByName[transferEventRow])
+	if err != nil {
+		return nil, 0, checkListError(err)
+	}
+
+	var total int
+	var events []*domain.TransferEvent
+	for _, row := range eventRows {
+		event, err := repo.unmarshal(row.TransferEvent)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		total = row.Total
+		events = append(events, event)
+	}
+
+	return events, total, nil
+}
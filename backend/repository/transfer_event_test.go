@@ -0,0 +1,73 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestTransferEventRepositoryCreate(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(transfer)
+	test.AssertNilError(t, err)
+
+	event, err := domain.NewTransferEvent(transfer, domain.TransferEventAcquired, "attempt 1")
+	test.AssertNilError(t, err)
+
+	event.SetWorkerID("host:123")
+
+	err = repo.TransferEvent.Create(event)
+	test.AssertNilError(t, err)
+
+	// creating a transfer starts its timeline
+	events, total, err := repo.TransferEvent.List(transfer, 10, 0)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, total, 2)
+	test.AssertEqual(t, len(events), 2)
+	test.AssertEqual(t, events[0].Kind(), domain.TransferEventQueued)
+	test.AssertEqual(t, events[1].Kind(), domain.TransferEventAcquired)
+	test.AssertEqual(t, events[1].WorkerID(), "host:123")
+	test.AssertEqual(t, events[1].Message(), "attempt 1")
+}
+
+func TestTransferEventRepositoryList(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(transfer)
+	test.AssertNilError(t, err)
+
+	for _, file := range []string{"a.txt", "b.txt", "c.txt"} {
+		event, err := domain.NewTransferEvent(transfer, domain.TransferEventFileStarted, "")
+		test.AssertNilError(t, err)
+
+		event.SetFile(file)
+
+		err = repo.TransferEvent.Create(event)
+		test.AssertNilError(t, err)
+	}
+
+	events, total, err := repo.TransferEvent.List(transfer, 2, 1)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, total, 4)
+	test.AssertEqual(t, len(events), 2)
+	test.AssertEqual(t, events[0].File(), "a.txt")
+	test.AssertEqual(t, events[1].File(), "b.txt")
+}
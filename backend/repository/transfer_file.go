@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/theandrew168/dripfile/backend/database"
+	"github.com/theandrew168/dripfile/backend/domain"
+)
+
+// ensure TransferFileRepository interface is satisfied
+var _ TransferFileRepository = (*PostgresTransferFileRepository)(nil)
+
+type TransferFileRepository interface {
+	Save(file *domain.TransferFile) error
+	List(transfer *domain.Transfer, limit, offset int) ([]*domain.TransferFile, int, error)
+}
+
+type TransferFile struct {
+	ID uuid.UUID `db:"id"`
+
+	TransferID uuid.UUID                 `db:"transfer_id"`
+	Name       string                    `db:"name"`
+	Dest       string                    `db:"dest"`
+	Size       int                       `db:"size"`
+	Checksum   string                    `db:"checksum"`
+	Status     domain.TransferFileStatus `db:"status"`
+	Error      string                    `db:"error"`
+	Attempts   int                       `db:"attempts"`
+
+	StartedAt  time.Time `db:"started_at"`
+	FinishedAt time.Time `db:"finished_at"`
+
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+type PostgresTransferFileRepository struct {
+	conn database.Conn
+}
+
+func NewPostgresTransferFileRepository(conn database.Conn) *PostgresTransferFileRepository {
+	repo := PostgresTransferFileRepository{
+		conn: conn,
+	}
+	return &repo
+}
+
+func (repo *PostgresTransferFileRepository) marshal(file *domain.TransferFile) (TransferFile, error) {
+	row := TransferFile{
+		ID: file.ID(),
+
+		TransferID: file.TransferID(),
+		Name:       file.Name(),
+		Dest:       file.Dest(),
+		Size:       file.Size(),
+		Checksum:   file.Checksum(),
+		Status:     file.Status(),
+		Error:      file.Error(),
+		Attempts:   file.Attempts(),
+
+		StartedAt:  file.StartedAt(),
+		FinishedAt: file.FinishedAt(),
+
+		CreatedAt: file.CreatedAt(),
+		UpdatedAt: file.UpdatedAt(),
+	}
+	return row, nil
+}
+
+func (repo *PostgresTransferFileRepository) unmarshal(row TransferFile) (*domain.TransferFile, error) {
+	file := domain.LoadTransferFile(
+		row.ID,
+		row.TransferID,
+		row.Name,
+		row.Dest,
+		row.Size,
+		row.Checksum,
+		row.Status,
+		row.Error,
+		row.Attempts,
+		row.StartedAt,
+		row.FinishedAt,
+		row.CreatedAt,
+		row.UpdatedAt,
+	)
+	return file, nil
+}
+
+// Record a file's outcome. A file that was already recorded by an earlier run
+// of the same transfer is updated instead (adding up the attempts of each run).
+func (repo *PostgresTransferFileRepository) Save(file *domain.TransferFile) error {
+	stmt := `
+		INSERT INTO transfer_file
+			(id, transfer_id, name, dest, size, checksum, status, error, attempts,
+			 started_at, finished_at, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (transfer_id, name) DO UPDATE
+		SET
+			dest = EXCLUDED.dest,
+			size = EXCLUDED.size,
+			checksum = EXCLUDED.checksum,
+			status = EXCLUDED.status,
+			error = EXCLUDED.error,
+			attempts = transfer_file.attempts + EXCLUDED.attempts,
+			started_at = EXCLUDED.started_at,
+			finished_at = EXCLUDED.finished_at,
+			updated_at = EXCLUDED.updated_at`
+
+	row, err := repo.marshal(file)
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		row.ID,
+		row.TransferID,
+		row.Name,
+		row.Dest,
+		row.Size,
+		row.Checksum,
+		row.Status,
+		row.Error,
+		row.Attempts,
+		row.StartedAt,
+		row.FinishedAt,
+		row.CreatedAt,
+		row.UpdatedAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	_, err = repo.conn.Exec(ctx, stmt, args...)
+	if err != nil {
+		return checkCreateError(err)
+	}
+
+	return nil
+}
+
+// List a page of a transfer's files (in the order they were handled) along
+// with the total number of files that it has.
+func (repo *PostgresTransferFileRepository) List(transfer *domain.Transfer, limit, offset int) ([]*domain.TransferFile, int, error) {
+	stmt := `
+		SELECT
+			count(*) OVER() AS total,
+			id,
+			transfer_id,
+			name,
+			dest,
+			size,
+			checksum,
+			status,
+			error,
+			attempts,
+			started_at,
+			finished_at,
+			created_at,
+			updated_at
+		FROM transfer_file
+		WHERE transfer_id = $1
+		ORDER BY started_at ASC, name ASC
+		LIMIT $2 OFFSET $3`
+
+	type transferFileRow struct {
+		TransferFile
+		Total int `db:"total"`
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.Timeout)
+	defer cancel()
+
+	rows, err := repo.conn.Query(ctx, stmt, transfer.ID(), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fileRows, err := pgx.CollectRows(rows, pgx.RowToStructByName[transferFileRow])
+	if err != nil {
+		return nil, 0, checkListError(err)
+	}
+
+	var total int
+	var files []*domain.TransferFile
+	for _, row := range fileRows {
+		file, err := repo.unmarshal(row.TransferFile)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		total = row.Total
+		files = append(files, file)
+	}
+
+	return files, total, nil
+}
@@ -0,0 +1,107 @@
+package repository_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestTransferFileRepositorySave(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(transfer)
+	test.AssertNilError(t, err)
+
+	result := fileserver.TransferResult{
+		Name:       "foo.txt",
+		Dest:       "foo.txt",
+		Action:     fileserver.ActionCopy,
+		Attempts:   3,
+		StartedAt:  time.Now(),
+		FinishedAt: time.Now(),
+	}
+
+	failed, err := domain.NewTransferFile(transfer, result, errors.New("broken pipe"))
+	test.AssertNilError(t, err)
+
+	err = repo.TransferFile.Save(failed)
+	test.AssertNilError(t, err)
+
+	// a later run finishes the same file
+	result.Size = 100
+	result.Checksum = "abc123"
+	result.Attempts = 1
+
+	succeeded, err := domain.NewTransferFile(transfer, result, nil)
+	test.AssertNilError(t, err)
+
+	err = repo.TransferFile.Save(succeeded)
+	test.AssertNilError(t, err)
+
+	files, total, err := repo.TransferFile.List(transfer, 10, 0)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, total, 1)
+	test.AssertEqual(t, len(files), 1)
+
+	file := files[0]
+	test.AssertEqual(t, file.ID(), failed.ID())
+	test.AssertEqual(t, file.Status(), domain.TransferFileStatusSuccess)
+	test.AssertEqual(t, file.Error(), "")
+	test.AssertEqual(t, file.Size(), 100)
+	test.AssertEqual(t, file.Checksum(), "abc123")
+	test.AssertEqual(t, file.Attempts(), 4)
+}
+
+func TestTransferFileRepositoryList(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(transfer)
+	test.AssertNilError(t, err)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		result := fileserver.TransferResult{
+			Name:       fmt.Sprintf("%d.txt", i),
+			Dest:       fmt.Sprintf("%d.txt", i),
+			Action:     fileserver.ActionCopy,
+			Attempts:   1,
+			StartedAt:  start.Add(time.Duration(i) * time.Second),
+			FinishedAt: start.Add(time.Duration(i) * time.Second),
+		}
+
+		file, err := domain.NewTransferFile(transfer, result, nil)
+		test.AssertNilError(t, err)
+
+		err = repo.TransferFile.Save(file)
+		test.AssertNilError(t, err)
+	}
+
+	// files are listed in the order they were handled
+	files, total, err := repo.TransferFile.List(transfer, 2, 2)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, total, 5)
+	test.AssertEqual(t, len(files), 2)
+	test.AssertEqual(t, files[0].Name(), "2.txt")
+	test.AssertEqual(t, files[1].Name(), "3.txt")
+}
@@ -1,11 +1,17 @@
 package repository_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/theandrew168/dripfile/backend/database"
 	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
 	"github.com/theandrew168/dripfile/backend/repository"
 	"github.com/theandrew168/dripfile/backend/test"
 )
@@ -41,6 +47,40 @@ func TestTransferRepositoryCreate(t *testing.T) {
 	test.AssertNilError(t, err)
 }
 
+func TestTransferRepositoryCreateDuplicateKey(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	key := uuid.NewString()
+
+	first, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = first.SetIdempotencyKey(key)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(first)
+	test.AssertNilError(t, err)
+
+	// a second transfer with the same key is rejected
+	second, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = second.SetIdempotencyKey(key)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(second)
+	test.AssertErrorIs(t, err, repository.ErrConflict)
+
+	got, err := repo.Transfer.Read(first.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.IdempotencyKey(), key)
+}
+
 func TestTransferRepositoryList(t *testing.T) {
 	t.Parallel()
 
@@ -163,6 +203,23 @@ func TestTransferRepositoryUpdate(t *testing.T) {
 	transfer.SetStatus(domain.TransferStatusSuccess)
 	transfer.SetProgress(100)
 
+	result := fileserver.TransferResult{
+		Name:   "foo.txt",
+		Dest:   "foo.txt",
+		Size:   100,
+		Action: fileserver.ActionCopy,
+	}
+	transfer.AddResult(result)
+
+	partial := fileserver.Partial{
+		Name:     "bar.txt",
+		Dest:     "bar.txt",
+		Action:   fileserver.ActionCopy,
+		UploadID: "upload",
+		Offset:   1024,
+	}
+	transfer.SetPartial(&partial)
+
 	err = repo.Transfer.Update(transfer)
 	test.AssertNilError(t, err)
 
@@ -171,6 +228,8 @@ func TestTransferRepositoryUpdate(t *testing.T) {
 
 	test.AssertEqual(t, transfer.Status(), domain.TransferStatusSuccess)
 	test.AssertEqual(t, transfer.Progress(), 100)
+	test.AssertSliceContains(t, transfer.Results(), result)
+	test.AssertEqual(t, transfer.Partial(), &partial)
 	test.AssertNotEqual(t, transfer.UpdatedAt(), transfer.CreatedAt())
 }
 
@@ -244,7 +303,476 @@ func TestTransferRepositoryAcquire(t *testing.T) {
 	err = repo.Transfer.Create(transfer)
 	test.AssertNilError(t, err)
 
-	transfer, err = repo.Transfer.Acquire()
+	transfer, err = repo.Transfer.Acquire(time.Minute)
 	test.AssertNilError(t, err)
 	test.AssertEqual(t, transfer.Status(), domain.TransferStatusRunning)
+	test.AssertNotEqual(t, transfer.Attempts(), 0)
+}
+
+func TestTransferRepositoryReadByIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	transfer, err := itinerary.NewTriggeredTransfer(uuid.NewString(), []string{"a.txt", "b.txt"})
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(transfer)
+	test.AssertNilError(t, err)
+
+	got, err := repo.Transfer.ReadByIdempotencyKey(transfer.IdempotencyKey())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.ID(), transfer.ID())
+	test.AssertEqual(t, len(got.Files()), 2)
+
+	_, err = repo.Transfer.ReadByIdempotencyKey(uuid.NewString())
+	test.AssertErrorIs(t, err, repository.ErrNotExist)
+}
+
+func TestTransferRepositoryCancel(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	// pending transfers are canceled right away
+	pending, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(pending)
+	test.AssertNilError(t, err)
+
+	err = pending.Cancel()
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Cancel(pending)
+	test.AssertNilError(t, err)
+
+	got, err := repo.Transfer.Read(pending.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.Status(), domain.TransferStatusCanceled)
+	test.AssertEqual(t, got.CancelRequested(), true)
+
+	// finished transfers can't be canceled again
+	err = repo.Transfer.Cancel(pending)
+	test.AssertErrorIs(t, err, repository.ErrConflict)
+
+	// running transfers are only flagged (without disturbing their worker)
+	running, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = running.SetStatus(domain.TransferStatusRunning)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(running)
+	test.AssertNilError(t, err)
+
+	worker, err := repo.Transfer.Read(running.ID())
+	test.AssertNilError(t, err)
+
+	err = running.Cancel()
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Cancel(running)
+	test.AssertNilError(t, err)
+
+	got, err = repo.Transfer.Read(running.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.Status(), domain.TransferStatusRunning)
+	test.AssertEqual(t, got.CancelRequested(), true)
+
+	err = worker.SetProgress(10)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Update(worker)
+	test.AssertNilError(t, err)
+}
+
+func TestTransferRepositoryListReruns(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = transfer.SetStatus(domain.TransferStatusSuccess)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(transfer)
+	test.AssertNilError(t, err)
+
+	rerun, err := transfer.Rerun(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(rerun)
+	test.AssertNilError(t, err)
+
+	got, err := repo.Transfer.Read(rerun.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.ParentID(), transfer.ID())
+
+	reruns, err := repo.Transfer.ListReruns(transfer)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, len(reruns), 1)
+	test.AssertEqual(t, reruns[0].ID(), rerun.ID())
+
+	// originals have no parent
+	got, err = repo.Transfer.Read(transfer.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.ParentID(), uuid.Nil)
+}
+
+func TestTransferRepositoryReapExpired(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = transfer.SetStatus(domain.TransferStatusRunning)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(transfer)
+	test.AssertNilError(t, err)
+
+	// a healthy lease keeps the transfer running
+	err = repo.Transfer.RenewLease(transfer, time.Minute)
+	test.AssertNilError(t, err)
+
+	reaped, err := repo.Transfer.ReapExpired()
+	test.AssertNilError(t, err)
+	for _, r := range reaped {
+		test.AssertNotEqual(t, r.ID(), transfer.ID())
+	}
+
+	// simulate a worker that stopped renewing its lease
+	err = repo.Transfer.RenewLease(transfer, -time.Minute)
+	test.AssertNilError(t, err)
+
+	_, err = repo.Transfer.ReapExpired()
+	test.AssertNilError(t, err)
+
+	got, err := repo.Transfer.Read(transfer.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.Status(), domain.TransferStatusPending)
+
+	// reaped transfers no longer hold a lease
+	err = repo.Transfer.RenewLease(transfer, time.Minute)
+	test.AssertErrorIs(t, err, repository.ErrConflict)
+}
+
+func TestTransferRepositoryRenewLeaseStaleAttempt(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = transfer.SetStatus(domain.TransferStatusRunning)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(transfer)
+	test.AssertNilError(t, err)
+
+	// a worker still holding onto an earlier attempt of the same transfer
+	stale := domain.LoadTransfer(
+		transfer.ID(),
+		transfer.ItineraryID(),
+		transfer.ParentID(),
+		transfer.Status(),
+		transfer.Progress(),
+		transfer.Error(),
+		transfer.Results(),
+		transfer.Partial(),
+		transfer.Priority(),
+		transfer.NotBefore(),
+		transfer.Attempts()-1,
+		transfer.NextAttemptAt(),
+		transfer.IdempotencyKey(),
+		transfer.Files(),
+		transfer.CancelRequestedAt(),
+		transfer.StuckOn(),
+		transfer.CreatedAt(),
+		transfer.UpdatedAt(),
+	)
+
+	err = repo.Transfer.RenewLease(stale, time.Minute)
+	test.AssertErrorIs(t, err, repository.ErrConflict)
+
+	err = repo.Transfer.RenewLease(transfer, time.Minute)
+	test.AssertNilError(t, err)
+}
+
+// Not parallel: draining the queue would steal transfers from other tests.
+func TestTransferRepositoryAcquireLocationLimit(t *testing.T) {
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	from, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = from.SetMaxActive(1)
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(from)
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(to)
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	err = repo.Itinerary.Create(itinerary)
+	test.AssertNilError(t, err)
+
+	// the source location is already at its limit
+	busy, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = busy.SetStatus(domain.TransferStatusRunning)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(busy)
+	test.AssertNilError(t, err)
+
+	waiting, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(waiting)
+	test.AssertNilError(t, err)
+
+	acquireAll := func() []uuid.UUID {
+		var ids []uuid.UUID
+		for {
+			transfer, err := repo.Transfer.Acquire(time.Minute)
+			if errors.Is(err, repository.ErrNotExist) {
+				return ids
+			}
+			test.AssertNilError(t, err)
+
+			ids = append(ids, transfer.ID())
+		}
+	}
+
+	for _, id := range acquireAll() {
+		test.AssertNotEqual(t, id, waiting.ID())
+	}
+
+	// finishing the running transfer frees up the location
+	err = busy.SetStatus(domain.TransferStatusSuccess)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Update(busy)
+	test.AssertNilError(t, err)
+
+	test.AssertSliceContains(t, acquireAll(), waiting.ID())
+}
+
+func TestTransferRepositoryCreateNotify(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	cfg := test.Config(t)
+	conn, err := database.Connect(cfg.DatabaseURI)
+	test.AssertNilError(t, err)
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(context.Background(), "LISTEN "+repository.TransferCreatedChannel)
+	test.AssertNilError(t, err)
+
+	itinerary := createItinerary(t, repo)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(transfer)
+	test.AssertNilError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// other tests may be creating transfers at the same time
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		test.AssertNilError(t, err)
+
+		if notification.Payload == transfer.ID().String() {
+			break
+		}
+	}
+}
+
+// Not parallel: draining the queue would steal transfers from other tests.
+func TestTransferRepositoryAcquirePriority(t *testing.T) {
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	bulk, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(bulk)
+	test.AssertNilError(t, err)
+
+	urgent, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = urgent.SetPriority(domain.MaxPriority)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(urgent)
+	test.AssertNilError(t, err)
+
+	later, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = later.SetPriority(domain.MaxPriority)
+	test.AssertNilError(t, err)
+
+	err = later.SetNotBefore(time.Now().Add(time.Hour))
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(later)
+	test.AssertNilError(t, err)
+
+	// the urgent transfer jumps the queue (and the later one waits)
+	order := make(map[uuid.UUID]int)
+	for i := 0; ; i++ {
+		transfer, err := repo.Transfer.Acquire(time.Minute)
+		if errors.Is(err, repository.ErrNotExist) {
+			break
+		}
+		test.AssertNilError(t, err)
+
+		order[transfer.ID()] = i
+	}
+
+	_, ok := order[later.ID()]
+	test.AssertEqual(t, ok, false)
+
+	urgentAt, ok := order[urgent.ID()]
+	test.AssertEqual(t, ok, true)
+
+	bulkAt, ok := order[bulk.ID()]
+	test.AssertEqual(t, ok, true)
+	test.AssertEqual(t, urgentAt < bulkAt, true)
+
+	got, err := repo.Transfer.Read(later.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.Priority(), domain.MaxPriority)
+	test.AssertEqual(t, got.NotBefore().IsZero(), false)
+}
+
+func TestTransferRepositoryTimeout(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	itinerary := createItinerary(t, repo)
+
+	err := itinerary.SetMaxDuration(time.Hour)
+	test.AssertNilError(t, err)
+
+	err = itinerary.SetIdleTimeout(time.Minute)
+	test.AssertNilError(t, err)
+
+	err = repo.Itinerary.Update(itinerary)
+	test.AssertNilError(t, err)
+
+	gotItinerary, err := repo.Itinerary.Read(itinerary.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, gotItinerary.MaxDuration(), time.Hour)
+	test.AssertEqual(t, gotItinerary.IdleTimeout(), time.Minute)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(transfer)
+	test.AssertNilError(t, err)
+
+	err = transfer.TimeOut("foo.txt", domain.ErrTransferTimeout)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Update(transfer)
+	test.AssertNilError(t, err)
+
+	got, err := repo.Transfer.Read(transfer.ID())
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, got.Status(), domain.TransferStatusTimeout)
+	test.AssertEqual(t, got.StuckOn(), "foo.txt")
+}
+
+func TestTransferRepositoryUpdateNotify(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	cfg := test.Config(t)
+	conn, err := database.Connect(cfg.DatabaseURI)
+	test.AssertNilError(t, err)
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(context.Background(), "LISTEN "+repository.TransferUpdatedChannel)
+	test.AssertNilError(t, err)
+
+	itinerary := createItinerary(t, repo)
+
+	transfer, err := domain.NewTransfer(itinerary)
+	test.AssertNilError(t, err)
+
+	err = repo.Transfer.Create(transfer)
+	test.AssertNilError(t, err)
+
+	transfer.SetProgress(42)
+
+	err = repo.Transfer.Update(transfer)
+	test.AssertNilError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	type update struct {
+		ID       uuid.UUID `json:"id"`
+		Progress int       `json:"progress"`
+	}
+
+	// other tests may be updating transfers at the same time
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		test.AssertNilError(t, err)
+
+		var got update
+		err = json.Unmarshal([]byte(notification.Payload), &got)
+		test.AssertNilError(t, err)
+
+		if got.ID == transfer.ID() && got.Progress == 42 {
+			break
+		}
+	}
 }
@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"io/fs"
 	"regexp"
 
 	"github.com/google/uuid"
@@ -72,3 +73,9 @@ func Unique[T comparable](values []T) bool {
 
 	return len(values) == len(uniqueValues)
 }
+
+// FileName returns true if a string value is a relative, slash-separated file
+// name without any empty, "." or ".." elements (so it can't escape its root).
+func FileName(value string) bool {
+	return value != "." && fs.ValidPath(value)
+}
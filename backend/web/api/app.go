@@ -13,15 +13,28 @@ import (
 type Application struct {
 	logger *slog.Logger
 	repo   *repository.Repository
+	broker *Broker
+
+	// largest file that can be uploaded into a location
+	maxUploadBytes int
+	// directories that local locations may be rooted within
+	allowedLocalRoots []string
 }
 
 func NewApplication(
 	logger *slog.Logger,
 	repo *repository.Repository,
+	broker *Broker,
+	maxUploadBytes int,
+	allowedLocalRoots []string,
 ) *Application {
 	app := Application{
 		logger: logger,
 		repo:   repo,
+		broker: broker,
+
+		maxUploadBytes:    maxUploadBytes,
+		allowedLocalRoots: allowedLocalRoots,
 	}
 	return &app
 }
@@ -41,15 +54,36 @@ func (app *Application) Handler() http.Handler {
 	mux.HandleFunc("/location/:id", app.handleLocationRead(), "GET")
 	mux.HandleFunc("/location/:id", app.handleLocationDelete(), "DELETE")
 	mux.HandleFunc("/location/:id/ping", app.handleLocationPing(), "POST")
+	mux.HandleFunc("/location/:id/files", app.handleLocationFileList(), "GET")
+	mux.HandleFunc("/location/:id/files", app.handleLocationFileUpload(), "PUT")
+	mux.HandleFunc("/location/:id/files/content", app.handleLocationFileContent(), "GET")
 
 	mux.HandleFunc("/itinerary", app.handleItineraryCreate(), "POST")
 	mux.HandleFunc("/itinerary", app.handleItineraryList(), "GET")
 	mux.HandleFunc("/itinerary/:id", app.handleItineraryRead(), "GET")
 	mux.HandleFunc("/itinerary/:id", app.handleItineraryDelete(), "DELETE")
+	mux.HandleFunc("/itinerary/:id/preview", app.handleItineraryPreview(), "POST")
+	mux.HandleFunc("/itinerary/:id/trigger", app.handleTrigger(), "POST")
+	mux.HandleFunc("/itinerary/:id/trigger/secret", app.handleTriggerSecretRotate(), "POST")
+	mux.HandleFunc("/itinerary/:id/trigger/secret", app.handleTriggerSecretDelete(), "DELETE")
 
 	mux.HandleFunc("/transfer", app.handleTransferCreate(), "POST")
 	mux.HandleFunc("/transfer", app.handleTransferList(), "GET")
+	mux.HandleFunc("/transfer/stream", app.handleTransferStreamList(), "GET")
 	mux.HandleFunc("/transfer/:id", app.handleTransferRead(), "GET")
+	mux.HandleFunc("/transfer/:id/stream", app.handleTransferStreamRead(), "GET")
+	mux.HandleFunc("/transfer/:id/files", app.handleTransferFileList(), "GET")
+	mux.HandleFunc("/transfer/:id/events", app.handleTransferEventList(), "GET")
+	mux.HandleFunc("/transfer/:id/cancel", app.handleTransferCancel(), "POST")
+	mux.HandleFunc("/transfer/:id/rerun", app.handleTransferRerun(), "POST")
+	mux.HandleFunc("/transfer/:id/retry-failed", app.handleTransferRetryFailed(), "POST")
+
+	mux.HandleFunc("/schedule", app.handleScheduleCreate(), "POST")
+	mux.HandleFunc("/schedule", app.handleScheduleList(), "GET")
+	mux.HandleFunc("/schedule/:id", app.handleScheduleRead(), "GET")
+	mux.HandleFunc("/schedule/:id", app.handleScheduleDelete(), "DELETE")
+	mux.HandleFunc("/schedule/:id/itinerary/:itineraryID", app.handleScheduleLink(), "POST")
+	mux.HandleFunc("/schedule/:id/itinerary/:itineraryID", app.handleScheduleUnlink(), "DELETE")
 
 	return mux
 }
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+)
+
+// How many updates a stream can fall behind by before it gets disconnected.
+const brokerBufferSize = 64
+
+// A change to a transfer's status or progress (as sent by Postgres).
+type TransferUpdate struct {
+	ID        uuid.UUID             `json:"id"`
+	Status    domain.TransferStatus `json:"status"`
+	Progress  int                   `json:"progress"`
+	UpdatedAt time.Time             `json:"updatedAt"`
+}
+
+func toTransferUpdate(transfer *domain.Transfer) TransferUpdate {
+	return TransferUpdate{
+		ID:        transfer.ID(),
+		Status:    transfer.Status(),
+		Progress:  transfer.Progress(),
+		UpdatedAt: transfer.UpdatedAt(),
+	}
+}
+
+// Fans out transfer updates to every open stream. Streams that can't keep up
+// are disconnected (instead of holding up the others) and are expected to
+// reconnect and catch up.
+type Broker struct {
+	logger *slog.Logger
+
+	mu          sync.Mutex
+	subscribers map[chan TransferUpdate]struct{}
+	closed      bool
+}
+
+func NewBroker(logger *slog.Logger) *Broker {
+	b := Broker{
+		logger:      logger,
+		subscribers: make(map[chan TransferUpdate]struct{}),
+	}
+	return &b
+}
+
+// Start receiving updates. The channel is closed if the subscriber falls too
+// far behind or the broker is closed. Call the returned func once done.
+func (b *Broker) Subscribe() (<-chan TransferUpdate, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	updates := make(chan TransferUpdate, brokerBufferSize)
+	if b.closed {
+		close(updates)
+		return updates, func() {}
+	}
+
+	b.subscribers[updates] = struct{}{}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		_, ok := b.subscribers[updates]
+		if ok {
+			delete(b.subscribers, updates)
+			close(updates)
+		}
+	}
+	return updates, unsubscribe
+}
+
+// Send a notification's payload to every subscriber (empty payloads, sent
+// whenever the listener reconnects, carry no update and are ignored).
+func (b *Broker) Publish(payload string) {
+	if payload == "" {
+		return
+	}
+
+	var update TransferUpdate
+	err := json.Unmarshal([]byte(payload), &update)
+	if err != nil {
+		b.logger.Error(err.Error(), "payload", payload)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for updates := range b.subscribers {
+		select {
+		case updates <- update:
+		default:
+			delete(b.subscribers, updates)
+			close(updates)
+		}
+	}
+}
+
+// Disconnect every subscriber (such as when the server is shutting down).
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for updates := range b.subscribers {
+		delete(b.subscribers, updates)
+		close(updates)
+	}
+	b.closed = true
+}
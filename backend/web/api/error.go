@@ -27,6 +27,12 @@ func (app *Application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 	app.errorResponse(w, r, code, err.Error())
 }
 
+func (app *Application) unauthorizedResponse(w http.ResponseWriter, r *http.Request) {
+	code := http.StatusUnauthorized
+	text := http.StatusText(code)
+	app.errorResponse(w, r, code, strings.ToLower(text))
+}
+
 func (app *Application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	code := http.StatusNotFound
 	text := http.StatusText(code)
@@ -45,6 +51,12 @@ func (app *Application) conflictResponse(w http.ResponseWriter, r *http.Request)
 	app.errorResponse(w, r, code, strings.ToLower(text))
 }
 
+func (app *Application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request) {
+	code := http.StatusRequestEntityTooLarge
+	text := http.StatusText(code)
+	app.errorResponse(w, r, code, strings.ToLower(text))
+}
+
 func (app *Application) unprocessableEntityResponse(w http.ResponseWriter, r *http.Request) {
 	code := http.StatusUnprocessableEntity
 	text := http.StatusText(code)
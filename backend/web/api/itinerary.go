@@ -10,6 +10,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
 	"github.com/theandrew168/dripfile/backend/repository"
 	"github.com/theandrew168/dripfile/backend/validator"
 )
@@ -17,24 +18,109 @@ import (
 type Itinerary struct {
 	ID uuid.UUID `json:"id"`
 
-	FromLocationID uuid.UUID `json:"fromLocationID"`
-	ToLocationID   uuid.UUID `json:"toLocationID"`
-	Pattern        string    `json:"pattern"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
+	FromLocationID uuid.UUID                 `json:"fromLocationID"`
+	ToLocationID   uuid.UUID                 `json:"toLocationID"`
+	Pattern        string                    `json:"pattern"`
+	Conflict       fileserver.ConflictPolicy `json:"conflict"`
+	Retry          RetryPolicy               `json:"retry"`
+	Marker         MarkerPolicy              `json:"marker"`
+
+	MaxBytesPerSecond int `json:"maxBytesPerSecond"`
+	Priority          int `json:"priority"`
+
+	PollInterval string     `json:"pollInterval,omitempty"`
+	PolledAt     *time.Time `json:"polledAt,omitempty"`
+
+	MaxDuration string `json:"maxDuration,omitempty"`
+	IdleTimeout string `json:"idleTimeout,omitempty"`
+
+	TriggerEnabled bool `json:"triggerEnabled"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type RetryPolicy struct {
+	MaxAttempts   int     `json:"maxAttempts"`
+	InitialDelay  string  `json:"initialDelay"`
+	BackoffFactor float64 `json:"backoffFactor"`
+	Jitter        float64 `json:"jitter"`
+}
+
+type MarkerPolicy struct {
+	Suffix   string                  `json:"suffix"`
+	Action   fileserver.MarkerAction `json:"action"`
+	Complete string                  `json:"complete"`
+}
+
+func toMarkerPolicy(marker fileserver.MarkerPolicy) MarkerPolicy {
+	return MarkerPolicy{
+		Suffix:   marker.Suffix,
+		Action:   marker.Action,
+		Complete: marker.Complete,
+	}
+}
+
+func toRetryPolicy(retry fileserver.RetryPolicy) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:   retry.MaxAttempts,
+		InitialDelay:  retry.InitialDelay.String(),
+		BackoffFactor: retry.BackoffFactor,
+		Jitter:        retry.Jitter,
+	}
+}
+
+// only include the poll interval for itineraries that are polled
+func toPollInterval(pollInterval time.Duration) string {
+	if pollInterval == 0 {
+		return ""
+	}
+
+	return pollInterval.String()
+}
+
+// only include timeouts that have been set
+func toTimeout(timeout time.Duration) string {
+	if timeout == 0 {
+		return ""
+	}
+
+	return timeout.String()
+}
+
+// only include the last poll time for itineraries that have been polled
+func toPolledAt(polledAt time.Time) *time.Time {
+	if polledAt.IsZero() {
+		return nil
+	}
+
+	return &polledAt
 }
 
 func (app *Application) handleItineraryCreate() http.HandlerFunc {
 	type request struct {
-		FromLocationID string `json:"fromLocationID"`
-		ToLocationID   string `json:"toLocationID"`
-		Pattern        string `json:"pattern"`
+		FromLocationID string        `json:"fromLocationID"`
+		ToLocationID   string        `json:"toLocationID"`
+		Pattern        string        `json:"pattern"`
+		Conflict       string        `json:"conflict"`
+		Retry          *RetryPolicy  `json:"retry"`
+		Marker         *MarkerPolicy `json:"marker"`
+
+		MaxBytesPerSecond int    `json:"maxBytesPerSecond"`
+		Priority          int    `json:"priority"`
+		PollInterval      string `json:"pollInterval"`
+		MaxDuration       string `json:"maxDuration"`
+		IdleTimeout       string `json:"idleTimeout"`
 	}
 
 	type response struct {
 		Itinerary Itinerary `json:"itinerary"`
 	}
 
+	type previewResponse struct {
+		Preview ItineraryPreview `json:"preview"`
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		v := validator.New()
 		body := readBody(w, r)
@@ -51,6 +137,89 @@ func (app *Application) handleItineraryCreate() http.HandlerFunc {
 		v.Check(req.ToLocationID != "", "toLocationID", "must be provided")
 		v.Check(req.Pattern != "", "pattern", "must be provided")
 
+		// conflict policy is optional (defaults to overwrite)
+		conflict := fileserver.ConflictPolicy(req.Conflict)
+		if req.Conflict != "" {
+			v.Check(
+				validator.PermittedValue(
+					conflict,
+					fileserver.ConflictOverwrite,
+					fileserver.ConflictSkip,
+					fileserver.ConflictFail,
+					fileserver.ConflictOverwriteIfNewer,
+					fileserver.ConflictRenameNumeric,
+					fileserver.ConflictRenameTimestamp,
+				),
+				"conflict",
+				"must be one of: overwrite, skip, fail, overwrite_if_newer, rename_numeric, rename_timestamp",
+			)
+		}
+
+		// retry policy is optional (defaults to fileserver.DefaultRetryPolicy)
+		var retry fileserver.RetryPolicy
+		if req.Retry != nil {
+			initialDelay, err := time.ParseDuration(req.Retry.InitialDelay)
+			if err != nil {
+				v.AddError("retry", "initialDelay must be a valid duration (such as 30s or 5m)")
+			}
+
+			retry = fileserver.RetryPolicy{
+				MaxAttempts:   req.Retry.MaxAttempts,
+				InitialDelay:  initialDelay,
+				BackoffFactor: req.Retry.BackoffFactor,
+				Jitter:        req.Retry.Jitter,
+			}
+		}
+
+		// marker policy is optional (defaults to not requiring markers)
+		marker := fileserver.DefaultMarkerPolicy
+		if req.Marker != nil {
+			marker = fileserver.MarkerPolicy{
+				Suffix:   req.Marker.Suffix,
+				Action:   req.Marker.Action,
+				Complete: req.Marker.Complete,
+			}
+			if marker.Action == "" {
+				marker.Action = fileserver.MarkerActionKeep
+			}
+
+			v.Check(
+				validator.PermittedValue(
+					marker.Action,
+					fileserver.MarkerActionKeep,
+					fileserver.MarkerActionDelete,
+					fileserver.MarkerActionCopy,
+				),
+				"marker",
+				"action must be one of: keep, delete, copy",
+			)
+		}
+
+		// poll interval is optional (defaults to never polling)
+		var pollInterval time.Duration
+		if req.PollInterval != "" {
+			pollInterval, err = time.ParseDuration(req.PollInterval)
+			if err != nil {
+				v.AddError("pollInterval", "must be a valid duration (such as 30s or 5m)")
+			}
+		}
+
+		// timeouts are optional (defaults to no limit)
+		var maxDuration time.Duration
+		if req.MaxDuration != "" {
+			maxDuration, err = time.ParseDuration(req.MaxDuration)
+			if err != nil {
+				v.AddError("maxDuration", "must be a valid duration (such as 30m or 2h)")
+			}
+		}
+		var idleTimeout time.Duration
+		if req.IdleTimeout != "" {
+			idleTimeout, err = time.ParseDuration(req.IdleTimeout)
+			if err != nil {
+				v.AddError("idleTimeout", "must be a valid duration (such as 30s or 5m)")
+			}
+		}
+
 		// check if provided IDs are valid UUIDs
 		fromLocationID, err := uuid.Parse(req.FromLocationID)
 		if err != nil {
@@ -97,6 +266,50 @@ func (app *Application) handleItineraryCreate() http.HandlerFunc {
 		itinerary, err := domain.NewItinerary(from, to, req.Pattern)
 		if err != nil {
 			v.AddError("itinerary", err.Error())
+		} else {
+			if req.Conflict != "" {
+				err = itinerary.SetConflict(conflict)
+				if err != nil {
+					v.AddError("conflict", err.Error())
+				}
+			}
+			if req.Retry != nil {
+				err = itinerary.SetRetry(retry)
+				if err != nil {
+					v.AddError("retry", err.Error())
+				}
+			}
+			if req.Marker != nil {
+				err = itinerary.SetMarker(marker)
+				if err != nil {
+					v.AddError("marker", err.Error())
+				}
+			}
+
+			err = itinerary.SetMaxBytesPerSecond(req.MaxBytesPerSecond)
+			if err != nil {
+				v.AddError("maxBytesPerSecond", err.Error())
+			}
+
+			err = itinerary.SetPriority(req.Priority)
+			if err != nil {
+				v.AddError("priority", fmt.Sprintf("must be between %d and %d", domain.MinPriority, domain.MaxPriority))
+			}
+
+			err = itinerary.SetPollInterval(pollInterval)
+			if err != nil {
+				v.AddError("pollInterval", fmt.Sprintf("must be zero or at least %s", domain.MinPollInterval))
+			}
+
+			err = itinerary.SetMaxDuration(maxDuration)
+			if err != nil {
+				v.AddError("maxDuration", "must not be negative")
+			}
+
+			err = itinerary.SetIdleTimeout(idleTimeout)
+			if err != nil {
+				v.AddError("idleTimeout", "must not be negative")
+			}
 		}
 
 		// ensure new itinerary satisfies domain constraints
@@ -105,6 +318,27 @@ func (app *Application) handleItineraryCreate() http.HandlerFunc {
 			return
 		}
 
+		// show what the itinerary would transfer instead of creating it
+		if r.URL.Query().Get("preview") == "true" {
+			preview, err := previewItinerary(itinerary, from, to)
+			if err != nil {
+				app.previewFailedResponse(w, r, err)
+				return
+			}
+
+			resp := previewResponse{
+				Preview: preview,
+			}
+
+			err = writeJSON(w, http.StatusOK, resp, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			return
+		}
+
 		err = app.repo.Itinerary.Create(itinerary)
 		if err != nil {
 			switch {
@@ -123,8 +357,23 @@ func (app *Application) handleItineraryCreate() http.HandlerFunc {
 			FromLocationID: itinerary.FromLocationID(),
 			ToLocationID:   itinerary.ToLocationID(),
 			Pattern:        itinerary.Pattern(),
-			CreatedAt:      itinerary.CreatedAt(),
-			UpdatedAt:      itinerary.UpdatedAt(),
+			Conflict:       itinerary.Conflict(),
+			Retry:          toRetryPolicy(itinerary.Retry()),
+			Marker:         toMarkerPolicy(itinerary.Marker()),
+
+			MaxBytesPerSecond: itinerary.MaxBytesPerSecond(),
+			Priority:          itinerary.Priority(),
+
+			PollInterval: toPollInterval(itinerary.PollInterval()),
+			PolledAt:     toPolledAt(itinerary.PolledAt()),
+
+			MaxDuration: toTimeout(itinerary.MaxDuration()),
+			IdleTimeout: toTimeout(itinerary.IdleTimeout()),
+
+			TriggerEnabled: itinerary.TriggerSecret() != "",
+
+			CreatedAt: itinerary.CreatedAt(),
+			UpdatedAt: itinerary.UpdatedAt(),
 		}
 		resp := response{
 			Itinerary: apiItinerary,
@@ -162,8 +411,23 @@ func (app *Application) handleItineraryList() http.HandlerFunc {
 				FromLocationID: itinerary.FromLocationID(),
 				ToLocationID:   itinerary.ToLocationID(),
 				Pattern:        itinerary.Pattern(),
-				CreatedAt:      itinerary.CreatedAt(),
-				UpdatedAt:      itinerary.UpdatedAt(),
+				Conflict:       itinerary.Conflict(),
+				Retry:          toRetryPolicy(itinerary.Retry()),
+				Marker:         toMarkerPolicy(itinerary.Marker()),
+
+				MaxBytesPerSecond: itinerary.MaxBytesPerSecond(),
+				Priority:          itinerary.Priority(),
+
+				PollInterval: toPollInterval(itinerary.PollInterval()),
+				PolledAt:     toPolledAt(itinerary.PolledAt()),
+
+				MaxDuration: toTimeout(itinerary.MaxDuration()),
+				IdleTimeout: toTimeout(itinerary.IdleTimeout()),
+
+				TriggerEnabled: itinerary.TriggerSecret() != "",
+
+				CreatedAt: itinerary.CreatedAt(),
+				UpdatedAt: itinerary.UpdatedAt(),
 			}
 			apiItineraries = append(apiItineraries, apiItinerary)
 		}
@@ -210,8 +474,23 @@ func (app *Application) handleItineraryRead() http.HandlerFunc {
 			FromLocationID: itinerary.FromLocationID(),
 			ToLocationID:   itinerary.ToLocationID(),
 			Pattern:        itinerary.Pattern(),
-			CreatedAt:      itinerary.CreatedAt(),
-			UpdatedAt:      itinerary.UpdatedAt(),
+			Conflict:       itinerary.Conflict(),
+			Retry:          toRetryPolicy(itinerary.Retry()),
+			Marker:         toMarkerPolicy(itinerary.Marker()),
+
+			MaxBytesPerSecond: itinerary.MaxBytesPerSecond(),
+			Priority:          itinerary.Priority(),
+
+			PollInterval: toPollInterval(itinerary.PollInterval()),
+			PolledAt:     toPolledAt(itinerary.PolledAt()),
+
+			MaxDuration: toTimeout(itinerary.MaxDuration()),
+			IdleTimeout: toTimeout(itinerary.IdleTimeout()),
+
+			TriggerEnabled: itinerary.TriggerSecret() != "",
+
+			CreatedAt: itinerary.CreatedAt(),
+			UpdatedAt: itinerary.UpdatedAt(),
 		}
 		resp := response{
 			Itinerary: apiItinerary,
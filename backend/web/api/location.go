@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path/filepath"
 	"time"
 
 	"github.com/alexedwards/flow"
 	"github.com/google/uuid"
 
 	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
 	"github.com/theandrew168/dripfile/backend/repository"
 	"github.com/theandrew168/dripfile/backend/validator"
 )
@@ -21,9 +23,13 @@ type Location struct {
 
 	Kind       domain.LocationKind `json:"kind"`
 	PingStatus domain.PingStatus   `json:"pingStatus"`
-	CreatedAt  time.Time           `json:"createdAt"`
-	UpdatedAt  time.Time           `json:"updatedAt"`
-	UsedBy     []uuid.UUID         `json:"usedBy"`
+
+	MaxBytesPerSecond int `json:"maxBytesPerSecond"`
+	MaxActive         int `json:"maxActive"`
+
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+	UsedBy    []uuid.UUID `json:"usedBy"`
 }
 
 func (app *Application) handleLocationCreate() http.HandlerFunc {
@@ -31,7 +37,9 @@ func (app *Application) handleLocationCreate() http.HandlerFunc {
 		Kind string `json:"kind"`
 	}
 	type requestMemory struct {
-		Kind string `json:"kind"`
+		Kind              string `json:"kind"`
+		MaxBytesPerSecond int    `json:"maxBytesPerSecond"`
+		MaxActive         int    `json:"maxActive"`
 	}
 	type requestS3 struct {
 		Kind            string `json:"kind"`
@@ -39,6 +47,19 @@ func (app *Application) handleLocationCreate() http.HandlerFunc {
 		Bucket          string `json:"bucket"`
 		AccessKeyID     string `json:"accessKeyID"`
 		SecretAccessKey string `json:"secretAccessKey"`
+		PartSize        int    `json:"partSize"`
+		Concurrency     int    `json:"concurrency"`
+
+		MaxBytesPerSecond int `json:"maxBytesPerSecond"`
+		MaxActive         int `json:"maxActive"`
+	}
+	type requestLocal struct {
+		Kind       string `json:"kind"`
+		Root       string `json:"root"`
+		SettleTime string `json:"settleTime"`
+
+		MaxBytesPerSecond int `json:"maxBytesPerSecond"`
+		MaxActive         int `json:"maxActive"`
 	}
 
 	type response struct {
@@ -66,9 +87,9 @@ func (app *Application) handleLocationCreate() http.HandlerFunc {
 
 		kind := domain.LocationKind(req.Kind)
 		v.Check(
-			validator.PermittedValue(kind, domain.LocationKindMemory, domain.LocationKindS3),
+			validator.PermittedValue(kind, domain.LocationKindMemory, domain.LocationKindS3, domain.LocationKindLocal),
 			"kind",
-			"must be one of: memory, s3",
+			"must be one of: memory, s3, local",
 		)
 		if !v.Valid() {
 			app.failedValidationResponse(w, r, v.Errors)
@@ -93,6 +114,16 @@ func (app *Application) handleLocationCreate() http.HandlerFunc {
 			location, err = domain.NewMemoryLocation()
 			if err != nil {
 				v.AddError("location", err.Error())
+			} else {
+				err = location.SetMaxBytesPerSecond(req.MaxBytesPerSecond)
+				if err != nil {
+					v.AddError("maxBytesPerSecond", err.Error())
+				}
+
+				err = location.SetMaxActive(req.MaxActive)
+				if err != nil {
+					v.AddError("maxActive", err.Error())
+				}
 			}
 		} else if kind == domain.LocationKindS3 {
 			var req requestS3
@@ -106,6 +137,12 @@ func (app *Application) handleLocationCreate() http.HandlerFunc {
 			v.Check(req.Bucket != "", "bucket", "must be provided")
 			v.Check(req.AccessKeyID != "", "accessKeyID", "must be provided")
 			v.Check(req.SecretAccessKey != "", "secretAccessKey", "must be provided")
+			v.Check(
+				req.PartSize == 0 || (req.PartSize >= fileserver.S3MinPartSize && req.PartSize <= fileserver.S3MaxPartSize),
+				"partSize",
+				"must be between 5MB and 256MB",
+			)
+			v.Check(req.Concurrency >= 0, "concurrency", "must not be negative")
 			if !v.Valid() {
 				app.failedValidationResponse(w, r, v.Errors)
 				return
@@ -119,6 +156,69 @@ func (app *Application) handleLocationCreate() http.HandlerFunc {
 			)
 			if err != nil {
 				v.AddError("location", err.Error())
+			} else {
+				err = location.SetS3Multipart(req.PartSize, req.Concurrency)
+				if err != nil {
+					v.AddError("location", err.Error())
+				}
+				err = location.SetMaxBytesPerSecond(req.MaxBytesPerSecond)
+				if err != nil {
+					v.AddError("maxBytesPerSecond", err.Error())
+				}
+
+				err = location.SetMaxActive(req.MaxActive)
+				if err != nil {
+					v.AddError("maxActive", err.Error())
+				}
+			}
+		} else if kind == domain.LocationKindLocal {
+			var req requestLocal
+			err = readJSON(bytes.NewReader(b), &req, true)
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+
+			v.Check(req.Root != "", "root", "must be provided")
+			v.Check(filepath.IsAbs(req.Root), "root", "must be an absolute path")
+
+			// only directories within the configured roots can be used
+			if req.Root != "" && filepath.IsAbs(req.Root) {
+				_, err = domain.CheckLocalRoot(req.Root, app.allowedLocalRoots)
+				if err != nil {
+					v.AddError("root", err.Error())
+				}
+			}
+
+			// settle time is optional (defaults to a couple seconds)
+			var settleTime time.Duration
+			if req.SettleTime != "" {
+				settleTime, err = time.ParseDuration(req.SettleTime)
+				v.Check(err == nil && settleTime >= 0, "settleTime", "must be a valid duration")
+			}
+
+			if !v.Valid() {
+				app.failedValidationResponse(w, r, v.Errors)
+				return
+			}
+
+			location, err = domain.NewLocalLocation(req.Root, app.allowedLocalRoots)
+			if err != nil {
+				v.AddError("location", err.Error())
+			} else {
+				err = location.SetLocalSettleTime(settleTime)
+				if err != nil {
+					v.AddError("settleTime", err.Error())
+				}
+				err = location.SetMaxBytesPerSecond(req.MaxBytesPerSecond)
+				if err != nil {
+					v.AddError("maxBytesPerSecond", err.Error())
+				}
+
+				err = location.SetMaxActive(req.MaxActive)
+				if err != nil {
+					v.AddError("maxActive", err.Error())
+				}
 			}
 		}
 
@@ -146,9 +246,13 @@ func (app *Application) handleLocationCreate() http.HandlerFunc {
 
 			Kind:       location.Kind(),
 			PingStatus: location.PingStatus(),
-			CreatedAt:  location.CreatedAt(),
-			UpdatedAt:  location.UpdatedAt(),
-			UsedBy:     location.UsedBy(),
+
+			MaxBytesPerSecond: location.MaxBytesPerSecond(),
+			MaxActive:         location.MaxActive(),
+
+			CreatedAt: location.CreatedAt(),
+			UpdatedAt: location.UpdatedAt(),
+			UsedBy:    location.UsedBy(),
 		}
 		resp := response{
 			Location: apiLocation,
@@ -185,9 +289,13 @@ func (app *Application) handleLocationList() http.HandlerFunc {
 
 				Kind:       location.Kind(),
 				PingStatus: location.PingStatus(),
-				CreatedAt:  location.CreatedAt(),
-				UpdatedAt:  location.UpdatedAt(),
-				UsedBy:     location.UsedBy(),
+
+				MaxBytesPerSecond: location.MaxBytesPerSecond(),
+				MaxActive:         location.MaxActive(),
+
+				CreatedAt: location.CreatedAt(),
+				UpdatedAt: location.UpdatedAt(),
+				UsedBy:    location.UsedBy(),
 			}
 			apiLocations = append(apiLocations, apiLocation)
 		}
@@ -233,9 +341,13 @@ func (app *Application) handleLocationRead() http.HandlerFunc {
 
 			Kind:       location.Kind(),
 			PingStatus: location.PingStatus(),
-			CreatedAt:  location.CreatedAt(),
-			UpdatedAt:  location.UpdatedAt(),
-			UsedBy:     location.UsedBy(),
+
+			MaxBytesPerSecond: location.MaxBytesPerSecond(),
+			MaxActive:         location.MaxActive(),
+
+			CreatedAt: location.CreatedAt(),
+			UpdatedAt: location.UpdatedAt(),
+			UsedBy:    location.UsedBy(),
 		}
 		resp := response{
 			Location: apiLocation,
@@ -342,9 +454,13 @@ func (app *Application) handleLocationPing() http.HandlerFunc {
 
 			Kind:       location.Kind(),
 			PingStatus: location.PingStatus(),
-			CreatedAt:  location.CreatedAt(),
-			UpdatedAt:  location.UpdatedAt(),
-			UsedBy:     location.UsedBy(),
+
+			MaxBytesPerSecond: location.MaxBytesPerSecond(),
+			MaxActive:         location.MaxActive(),
+
+			CreatedAt: location.CreatedAt(),
+			UpdatedAt: location.UpdatedAt(),
+			UsedBy:    location.UsedBy(),
 		}
 		resp := response{
 			Location: apiLocation,
@@ -0,0 +1,379 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/alexedwards/flow"
+	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/repository"
+	"github.com/theandrew168/dripfile/backend/validator"
+)
+
+type LocationFile struct {
+	Name    string    `json:"name"`
+	Size    int       `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Read a location by the ID in the request's path (responding with an error if
+// that isn't possible).
+func (app *Application) readLocation(w http.ResponseWriter, r *http.Request) (*domain.Location, bool) {
+	id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	location, err := app.repo.Location.Read(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotExist):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return nil, false
+	}
+
+	return location, true
+}
+
+// Respond with an error from talking to a location's file server.
+func (app *Application) fileServerErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	code := http.StatusBadGateway
+	app.errorResponse(w, r, code, fmt.Sprintf("unable to access location: %v", err))
+}
+
+// Cursors are the (encoded) name of the last file on the previous page.
+func encodeCursor(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	name, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return string(name), nil
+}
+
+func (app *Application) handleLocationFileList() http.HandlerFunc {
+	type response struct {
+		Files      []LocationFile `json:"files"`
+		NextCursor string         `json:"nextCursor,omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+		qs := r.URL.Query()
+
+		prefix := qs.Get("prefix")
+
+		// patterns match full names (and "*" stops at a "/") so by default list
+		// everything directly beneath the prefix
+		pattern := qs.Get("pattern")
+		if pattern == "" {
+			pattern = prefix + "*"
+		}
+
+		_, err := filepath.Match(pattern, "")
+		v.Check(err == nil, "pattern", "must be a valid glob pattern")
+
+		after, err := decodeCursor(qs.Get("cursor"))
+		v.Check(err == nil, "cursor", "must be a cursor returned by a previous page")
+
+		pageSize := readInt(qs, "pageSize", DefaultPageSize, v)
+		v.Check(pageSize > 0, "pageSize", "must be greater than zero")
+		v.Check(pageSize <= MaxPageSize, "pageSize", "must be a maximum of "+strconv.Itoa(MaxPageSize))
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		location, ok := app.readLocation(w, r)
+		if !ok {
+			return
+		}
+
+		fs, err := location.Connect()
+		if err != nil {
+			app.fileServerErrorResponse(w, r, err)
+			return
+		}
+
+		// list one extra file to find out whether there is another page
+		opts := fileserver.ListOptions{
+			Prefix:  prefix,
+			Pattern: pattern,
+			After:   after,
+			Limit:   pageSize + 1,
+		}
+		files, err := fileserver.List(fs, opts)
+		if err != nil {
+			app.fileServerErrorResponse(w, r, err)
+			return
+		}
+
+		resp := response{}
+		if len(files) > pageSize {
+			files = files[:pageSize]
+			resp.NextCursor = encodeCursor(files[len(files)-1].Name)
+		}
+
+		// use make here to encode JSON as "[]" instead of "null" if empty
+		resp.Files = make([]LocationFile, 0)
+		for _, file := range files {
+			resp.Files = append(resp.Files, LocationFile{
+				Name:    file.Name,
+				Size:    file.Size,
+				ModTime: file.ModTime,
+			})
+		}
+
+		err = writeJSON(w, http.StatusOK, resp, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
+
+// Counts an upload's bytes and remembers why reading it failed (so that a
+// client going away or sending too much isn't blamed on the location).
+type uploadReader struct {
+	r   io.Reader
+	n   int
+	err error
+}
+
+func (ur *uploadReader) Read(p []byte) (int, error) {
+	n, err := ur.r.Read(p)
+	ur.n += n
+	if err != nil && err != io.EOF {
+		ur.err = err
+	}
+	return n, err
+}
+
+// Remove the server's read and write deadlines from a single request. The
+// write deadline starts with the request so it would otherwise cut off the
+// response to any upload that takes longer to read.
+func clearDeadlines(w http.ResponseWriter) error {
+	rc := http.NewResponseController(w)
+	err := rc.SetReadDeadline(time.Time{})
+	if err != nil {
+		return err
+	}
+
+	return rc.SetWriteDeadline(time.Time{})
+}
+
+// Upload a single file into a location. The body is multipart form data whose
+// "file" part is streamed straight to the location (rather than being held in
+// memory) and may be as large as the configured max upload size.
+func (app *Application) handleLocationFileUpload() http.HandlerFunc {
+	type response struct {
+		File LocationFile `json:"file"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+
+		name := r.URL.Query().Get("name")
+		v.Check(name != "", "name", "must be provided")
+		v.Check(validator.FileName(name), "name", "must be a relative file name")
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		location, ok := app.readLocation(w, r)
+		if !ok {
+			return
+		}
+
+		// large files take much longer than the server's timeouts allow (so
+		// clear them before reading any of the body)
+		err := clearDeadlines(w)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// uploads are limited separately from (and more generously than) JSON bodies
+		r.Body = http.MaxBytesReader(w, r.Body, int64(app.maxUploadBytes))
+
+		mr, err := r.MultipartReader()
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		// skip over any other form fields until the file is found
+		var part *multipart.Part
+		for {
+			part, err = mr.NextPart()
+			if err != nil {
+				var maxBytesError *http.MaxBytesError
+				switch {
+				case errors.Is(err, io.EOF):
+					app.badRequestResponse(w, r, errors.New("body must contain a \"file\" part"))
+				case errors.As(err, &maxBytesError):
+					app.payloadTooLargeResponse(w, r)
+				default:
+					app.badRequestResponse(w, r, err)
+				}
+
+				return
+			}
+
+			if part.FormName() == "file" {
+				break
+			}
+		}
+		defer part.Close()
+
+		fs, err := location.Connect()
+		if err != nil {
+			app.fileServerErrorResponse(w, r, err)
+			return
+		}
+
+		upload := &uploadReader{r: part}
+		info := fileserver.FileInfo{
+			Name:    name,
+			Size:    fileserver.UnknownSize,
+			ModTime: time.Now(),
+		}
+
+		err = fs.Write(info, upload)
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.As(upload.err, &maxBytesError):
+				app.payloadTooLargeResponse(w, r)
+			case upload.err != nil:
+				app.badRequestResponse(w, r, upload.err)
+			default:
+				app.fileServerErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		resp := response{
+			File: LocationFile{
+				Name:    info.Name,
+				Size:    upload.n,
+				ModTime: info.ModTime,
+			},
+		}
+
+		err = writeJSON(w, http.StatusCreated, resp, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
+
+// Download a single file from a location (without handing out its credentials).
+func (app *Application) handleLocationFileContent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+
+		name := r.URL.Query().Get("name")
+		v.Check(name != "", "name", "must be provided")
+		v.Check(validator.FileName(name), "name", "must be a relative file name")
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		location, ok := app.readLocation(w, r)
+		if !ok {
+			return
+		}
+
+		fs, err := location.Connect()
+		if err != nil {
+			app.fileServerErrorResponse(w, r, err)
+			return
+		}
+
+		info, err := fs.Stat(name)
+		if err != nil {
+			switch {
+			case errors.Is(err, fileserver.ErrNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.fileServerErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		file, err := fs.Read(name)
+		if err != nil {
+			switch {
+			case errors.Is(err, fileserver.ErrNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.fileServerErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		if closer, ok := file.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		// large files take much longer than the server's write timeout allows
+		rc := http.NewResponseController(w)
+		err = rc.SetWriteDeadline(time.Time{})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		disposition := mime.FormatMediaType("attachment", map[string]string{
+			"filename": path.Base(info.Name),
+		})
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", disposition)
+		if info.Size != fileserver.UnknownSize {
+			w.Header().Set("Content-Length", strconv.Itoa(info.Size))
+		}
+		if !info.ModTime.IsZero() {
+			w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+		}
+		w.WriteHeader(http.StatusOK)
+
+		// the status has already been sent, so all that's left is to log
+		_, err = io.Copy(w, file)
+		if err != nil {
+			app.logger.Error(err.Error(), "location", location.ID(), "name", name)
+			return
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestClearDeadlines(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := clearDeadlines(w)
+		test.AssertNilError(t, err)
+
+		body, err := io.ReadAll(r.Body)
+		test.AssertNilError(t, err)
+
+		w.Write(body)
+	})
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ReadTimeout = 100 * time.Millisecond
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// stream a body that takes longer than both timeouts to arrive
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("slow "))
+		time.Sleep(300 * time.Millisecond)
+		pw.Write([]byte("upload"))
+		pw.Close()
+	}()
+
+	resp, err := http.Post(server.URL, "text/plain", pr)
+	test.AssertNilError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	test.AssertNilError(t, err)
+	test.AssertEqual(t, resp.StatusCode, http.StatusOK)
+	test.AssertEqual(t, string(body), "slow upload")
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/theandrew168/dripfile/backend/validator"
+)
+
+// Based on:
+// Let's Go Further - Chapter 9.3 (Alex Edwards)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// Which page of a (potentially long) list to return.
+type Page struct {
+	Page     int
+	PageSize int
+}
+
+// Read the "page" and "pageSize" query params (falling back to the defaults).
+func readPage(qs url.Values, v *validator.Validator) Page {
+	page := Page{
+		Page:     readInt(qs, "page", 1, v),
+		PageSize: readInt(qs, "pageSize", DefaultPageSize, v),
+	}
+
+	v.Check(page.Page > 0, "page", "must be greater than zero")
+	v.Check(page.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.Check(page.PageSize > 0, "pageSize", "must be greater than zero")
+	v.Check(page.PageSize <= MaxPageSize, "pageSize", "must be a maximum of "+strconv.Itoa(MaxPageSize))
+
+	return page
+}
+
+func (p Page) Limit() int {
+	return p.PageSize
+}
+
+func (p Page) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+func readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// Where a page sits within the full list.
+type Metadata struct {
+	CurrentPage  int `json:"currentPage"`
+	PageSize     int `json:"pageSize"`
+	LastPage     int `json:"lastPage"`
+	TotalRecords int `json:"totalRecords"`
+}
+
+func toMetadata(page Page, totalRecords int) Metadata {
+	metadata := Metadata{
+		CurrentPage:  page.Page,
+		PageSize:     page.PageSize,
+		LastPage:     max((totalRecords+page.PageSize-1)/page.PageSize, 1),
+		TotalRecords: totalRecords,
+	}
+	return metadata
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/alexedwards/flow"
+	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/repository"
+)
+
+// What a transfer of an itinerary would do right now.
+type ItineraryPreview struct {
+	Files []PreviewFile `json:"files"`
+
+	// files that would be written (and how many bytes they add up to)
+	TotalFiles int `json:"totalFiles"`
+	TotalBytes int `json:"totalBytes"`
+
+	Skipped     int `json:"skipped"`
+	Overwritten int `json:"overwritten"`
+}
+
+type PreviewFile struct {
+	Name   string            `json:"name"`
+	Dest   string            `json:"dest"`
+	Size   int               `json:"size"`
+	Action fileserver.Action `json:"action"`
+	Reason string            `json:"reason,omitempty"`
+}
+
+// Connect to an itinerary's locations and work out what a transfer would do
+// (without writing anything).
+func previewItinerary(itinerary *domain.Itinerary, from, to *domain.Location) (ItineraryPreview, error) {
+	fromFS, err := from.Connect()
+	if err != nil {
+		return ItineraryPreview{}, err
+	}
+
+	toFS, err := to.Connect()
+	if err != nil {
+		return ItineraryPreview{}, err
+	}
+
+	opts := fileserver.TransferOptions{
+		Conflict: itinerary.Conflict(),
+		Marker:   itinerary.Marker(),
+	}
+	results, err := fileserver.Preview(itinerary.Pattern(), fromFS, toFS, opts)
+	if err != nil {
+		return ItineraryPreview{}, err
+	}
+
+	// use make here to encode JSON as "[]" instead of "null" if empty
+	preview := ItineraryPreview{
+		Files: make([]PreviewFile, 0),
+	}
+	for _, result := range results {
+		preview.Files = append(preview.Files, PreviewFile{
+			Name:   result.Name,
+			Dest:   result.Dest,
+			Size:   result.Size,
+			Action: result.Action,
+			Reason: result.Reason,
+		})
+
+		switch result.Action {
+		case fileserver.ActionSkip:
+			preview.Skipped++
+			continue
+		case fileserver.ActionOverwrite:
+			preview.Overwritten++
+		}
+
+		preview.TotalFiles++
+		preview.TotalBytes += result.Size
+	}
+
+	return preview, nil
+}
+
+// Respond with an error from connecting to (or listing) a location.
+func (app *Application) previewFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	code := http.StatusBadGateway
+	app.errorResponse(w, r, code, fmt.Sprintf("unable to preview itinerary: %v", err))
+}
+
+func (app *Application) handleItineraryPreview() http.HandlerFunc {
+	type response struct {
+		Preview ItineraryPreview `json:"preview"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		itinerary, err := app.repo.Itinerary.Read(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		from, err := app.repo.Location.Read(itinerary.FromLocationID())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		to, err := app.repo.Location.Read(itinerary.ToLocationID())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		preview, err := previewItinerary(itinerary, from, to)
+		if err != nil {
+			app.previewFailedResponse(w, r, err)
+			return
+		}
+
+		resp := response{
+			Preview: preview,
+		}
+
+		err = writeJSON(w, http.StatusOK, resp, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexedwards/flow"
+	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/repository"
+	"github.com/theandrew168/dripfile/backend/validator"
+)
+
+type Schedule struct {
+	ID uuid.UUID `json:"id"`
+
+	Expr         string      `json:"expr"`
+	Timezone     string      `json:"timezone"`
+	NextRunAt    time.Time   `json:"nextRunAt"`
+	ItineraryIDs []uuid.UUID `json:"itineraryIDs"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	UpdatedAt    time.Time   `json:"updatedAt"`
+}
+
+func toSchedule(schedule *domain.Schedule) Schedule {
+	// use make here to encode JSON as "[]" instead of "null" if empty
+	itineraryIDs := make([]uuid.UUID, 0)
+	itineraryIDs = append(itineraryIDs, schedule.ItineraryIDs()...)
+
+	return Schedule{
+		ID: schedule.ID(),
+
+		Expr:         schedule.Expr(),
+		Timezone:     schedule.Timezone(),
+		NextRunAt:    schedule.NextRunAt(),
+		ItineraryIDs: itineraryIDs,
+		CreatedAt:    schedule.CreatedAt(),
+		UpdatedAt:    schedule.UpdatedAt(),
+	}
+}
+
+func (app *Application) handleScheduleCreate() http.HandlerFunc {
+	type request struct {
+		Expr         string   `json:"expr"`
+		Timezone     string   `json:"timezone"`
+		ItineraryIDs []string `json:"itineraryIDs"`
+	}
+
+	type response struct {
+		Schedule Schedule `json:"schedule"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+		body := readBody(w, r)
+
+		var req request
+		err := readJSON(body, &req, true)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		// check if provided info passes basic validation
+		v.Check(req.Expr != "", "expr", "must be provided")
+
+		// time zone is optional (defaults to UTC)
+		timezone := req.Timezone
+		if timezone == "" {
+			timezone = "UTC"
+		}
+
+		// check if provided IDs are valid UUIDs
+		var itineraryIDs []uuid.UUID
+		for _, id := range req.ItineraryIDs {
+			itineraryID, err := uuid.Parse(id)
+			if err != nil {
+				v.AddError("itineraryIDs", "must be the IDs of existing itineraries")
+				continue
+			}
+
+			itineraryIDs = append(itineraryIDs, itineraryID)
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		var itineraries []*domain.Itinerary
+		for _, itineraryID := range itineraryIDs {
+			itinerary, err := app.repo.Itinerary.Read(itineraryID)
+			if err != nil {
+				switch {
+				case errors.Is(err, repository.ErrNotExist):
+					v.AddError("itineraryIDs", "must be the IDs of existing itineraries")
+					continue
+				default:
+					app.serverErrorResponse(w, r, err)
+					return
+				}
+			}
+
+			itineraries = append(itineraries, itinerary)
+		}
+
+		// check if provided IDs correspond to existing entities
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		schedule, err := domain.NewSchedule(req.Expr, timezone)
+		if err != nil {
+			switch {
+			case errors.Is(err, domain.ErrScheduleInvalidExpr):
+				v.AddError("expr", "must be a valid cron expression")
+			case errors.Is(err, domain.ErrScheduleInvalidTimezone):
+				v.AddError("timezone", "must be a valid IANA time zone")
+			default:
+				v.AddError("schedule", err.Error())
+			}
+		} else {
+			for _, itinerary := range itineraries {
+				err = schedule.Link(itinerary)
+				if err != nil {
+					v.AddError("itineraryIDs", err.Error())
+				}
+			}
+		}
+
+		// ensure new schedule satisfies domain constraints
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = app.repo.Schedule.Create(schedule)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrConflict):
+				app.conflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		resp := response{
+			Schedule: toSchedule(schedule),
+		}
+
+		header := make(http.Header)
+		header.Set("Location", fmt.Sprintf("/api/v1/schedule/%s", schedule.ID()))
+
+		err = writeJSON(w, http.StatusCreated, resp, header)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
+
+func (app *Application) handleScheduleList() http.HandlerFunc {
+	type response struct {
+		Schedules []Schedule `json:"schedules"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		schedules, err := app.repo.Schedule.List()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// use make here to encode JSON as "[]" instead of "null" if empty
+		apiSchedules := make([]Schedule, 0)
+		for _, schedule := range schedules {
+			apiSchedules = append(apiSchedules, toSchedule(schedule))
+		}
+
+		resp := response{
+			Schedules: apiSchedules,
+		}
+
+		err = writeJSON(w, http.StatusOK, resp, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
+
+func (app *Application) handleScheduleRead() http.HandlerFunc {
+	type response struct {
+		Schedule Schedule `json:"schedule"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		schedule, err := app.repo.Schedule.Read(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		resp := response{
+			Schedule: toSchedule(schedule),
+		}
+
+		err = writeJSON(w, http.StatusOK, resp, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
+
+func (app *Application) handleScheduleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		schedule, err := app.repo.Schedule.Read(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		err = app.repo.Schedule.Delete(schedule)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (app *Application) handleScheduleLink() http.HandlerFunc {
+	return app.handleScheduleLinkChange(func(schedule *domain.Schedule, itinerary *domain.Itinerary) error {
+		return schedule.Link(itinerary)
+	})
+}
+
+func (app *Application) handleScheduleUnlink() http.HandlerFunc {
+	return app.handleScheduleLinkChange(func(schedule *domain.Schedule, itinerary *domain.Itinerary) error {
+		return schedule.Unlink(itinerary)
+	})
+}
+
+// Shared logic for linking / unlinking an itinerary and a schedule.
+func (app *Application) handleScheduleLinkChange(change func(*domain.Schedule, *domain.Itinerary) error) http.HandlerFunc {
+	type response struct {
+		Schedule Schedule `json:"schedule"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		itineraryID, err := uuid.Parse(flow.Param(r.Context(), "itineraryID"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		schedule, err := app.repo.Schedule.Read(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		itinerary, err := app.repo.Itinerary.Read(itineraryID)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		err = change(schedule, itinerary)
+		if err != nil {
+			switch {
+			case errors.Is(err, domain.ErrScheduleAlreadyLinked):
+				app.conflictResponse(w, r)
+			case errors.Is(err, domain.ErrScheduleNotLinked):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		err = app.repo.Schedule.Update(schedule)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrConflict):
+				app.conflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		resp := response{
+			Schedule: toSchedule(schedule),
+		}
+
+		err = writeJSON(w, http.StatusOK, resp, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
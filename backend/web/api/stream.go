@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexedwards/flow"
+	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/repository"
+)
+
+// How often to send a comment down an otherwise quiet stream (so that proxies
+// don't consider it idle and close it).
+const streamKeepAliveInterval = 15 * time.Second
+
+// Stream updates for every transfer.
+func (app *Application) handleTransferStreamList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.streamTransferUpdates(w, r, nil, func(TransferUpdate) bool {
+			return true
+		})
+	}
+}
+
+// Stream updates for a single transfer (starting with its current state).
+func (app *Application) handleTransferStreamRead() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		transfer, err := app.repo.Transfer.Read(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		current := toTransferUpdate(transfer)
+		app.streamTransferUpdates(w, r, &current, func(update TransferUpdate) bool {
+			return update.ID == id
+		})
+	}
+}
+
+// Send matching transfer updates as Server-Sent Events until the client goes
+// away (or the stream falls too far behind and has to reconnect).
+func (app *Application) streamTransferUpdates(w http.ResponseWriter, r *http.Request, current *TransferUpdate, match func(TransferUpdate) bool) {
+	// subscribe before sending the current state so that nothing is missed
+	updates, unsubscribe := app.broker.Subscribe()
+	defer unsubscribe()
+
+	// streams last much longer than the server's write timeout allows
+	rc := http.NewResponseController(w)
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(update TransferUpdate) error {
+		data, err := json.Marshal(update)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "event: transfer\ndata: %s\n\n", data)
+		if err != nil {
+			return err
+		}
+
+		return rc.Flush()
+	}
+
+	if current != nil {
+		err = send(*current)
+	} else {
+		err = rc.Flush()
+	}
+	if err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(streamKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+
+			if !match(update) {
+				continue
+			}
+
+			err := send(update)
+			if err != nil {
+				return
+			}
+		case <-ticker.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+
+			err = rc.Flush()
+			if err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
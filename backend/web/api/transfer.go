@@ -10,6 +10,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
 	"github.com/theandrew168/dripfile/backend/repository"
 	"github.com/theandrew168/dripfile/backend/validator"
 )
@@ -17,16 +18,115 @@ import (
 type Transfer struct {
 	ID uuid.UUID `json:"id"`
 
-	ItineraryID uuid.UUID             `json:"itineraryID"`
-	Status      domain.TransferStatus `json:"status"`
-	Progress    int                   `json:"progress"`
-	CreatedAt   time.Time             `json:"createdAt"`
-	UpdatedAt   time.Time             `json:"updatedAt"`
+	ItineraryID   uuid.UUID             `json:"itineraryID"`
+	ParentID      *uuid.UUID            `json:"parentID,omitempty"`
+	Status        domain.TransferStatus `json:"status"`
+	Progress      int                   `json:"progress"`
+	Results       []TransferResult      `json:"results"`
+	Priority      int                   `json:"priority"`
+	NotBefore     *time.Time            `json:"notBefore,omitempty"`
+	Attempts      int                   `json:"attempts"`
+	NextAttemptAt *time.Time            `json:"nextAttemptAt,omitempty"`
+	Files         []string              `json:"files,omitempty"`
+
+	CancelRequestedAt *time.Time `json:"cancelRequestedAt,omitempty"`
+	StuckOn           string     `json:"stuckOn,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type TransferResult struct {
+	Name   string            `json:"name"`
+	Dest   string            `json:"dest"`
+	Size   int               `json:"size"`
+	Action fileserver.Action `json:"action"`
+}
+
+// only include the next attempt time for transfers that are waiting to retry
+func toNextAttempt(transfer *domain.Transfer) *time.Time {
+	if transfer.Status() != domain.TransferStatusRetrying {
+		return nil
+	}
+
+	nextAttemptAt := transfer.NextAttemptAt()
+	return &nextAttemptAt
+}
+
+func toTransfer(transfer *domain.Transfer) Transfer {
+	return Transfer{
+		ID: transfer.ID(),
+
+		ItineraryID:   transfer.ItineraryID(),
+		ParentID:      toParentID(transfer),
+		Status:        transfer.Status(),
+		Progress:      transfer.Progress(),
+		Results:       toTransferResults(transfer.Results()),
+		Priority:      transfer.Priority(),
+		NotBefore:     toNotBefore(transfer),
+		Attempts:      transfer.Attempts(),
+		NextAttemptAt: toNextAttempt(transfer),
+		Files:         transfer.Files(),
+
+		CancelRequestedAt: toCancelRequestedAt(transfer),
+		StuckOn:           transfer.StuckOn(),
+
+		CreatedAt: transfer.CreatedAt(),
+		UpdatedAt: transfer.UpdatedAt(),
+	}
+}
+
+// only include the earliest start time for transfers that have one
+func toNotBefore(transfer *domain.Transfer) *time.Time {
+	if transfer.NotBefore().IsZero() {
+		return nil
+	}
+
+	notBefore := transfer.NotBefore()
+	return &notBefore
+}
+
+// only include the parent for transfers that reran or retried another
+func toParentID(transfer *domain.Transfer) *uuid.UUID {
+	if transfer.ParentID() == uuid.Nil {
+		return nil
+	}
+
+	parentID := transfer.ParentID()
+	return &parentID
+}
+
+// only include the cancellation time for transfers that were asked to stop
+func toCancelRequestedAt(transfer *domain.Transfer) *time.Time {
+	if !transfer.CancelRequested() {
+		return nil
+	}
+
+	cancelRequestedAt := transfer.CancelRequestedAt()
+	return &cancelRequestedAt
+}
+
+func toTransferResults(results []fileserver.TransferResult) []TransferResult {
+	// use make here to encode JSON as "[]" instead of "null" if empty
+	apiResults := make([]TransferResult, 0)
+	for _, result := range results {
+		apiResult := TransferResult{
+			Name:   result.Name,
+			Dest:   result.Dest,
+			Size:   result.Size,
+			Action: result.Action,
+		}
+		apiResults = append(apiResults, apiResult)
+	}
+
+	return apiResults
 }
 
 func (app *Application) handleTransferCreate() http.HandlerFunc {
 	type request struct {
-		ItineraryID string `json:"itineraryID"`
+		ItineraryID string     `json:"itineraryID"`
+		Priority    *int       `json:"priority"`
+		NotBefore   *time.Time `json:"notBefore"`
 	}
 
 	type response struct {
@@ -78,6 +178,20 @@ func (app *Application) handleTransferCreate() http.HandlerFunc {
 		transfer, err := domain.NewTransfer(itinerary)
 		if err != nil {
 			v.AddError("transfer", err.Error())
+		} else {
+			// override the itinerary's default priority
+			if req.Priority != nil {
+				err = transfer.SetPriority(*req.Priority)
+				if err != nil {
+					v.AddError("priority", fmt.Sprintf("must be between %d and %d", domain.MinPriority, domain.MaxPriority))
+				}
+			}
+			if req.NotBefore != nil {
+				err = transfer.SetNotBefore(*req.NotBefore)
+				if err != nil {
+					v.AddError("notBefore", err.Error())
+				}
+			}
 		}
 
 		// ensure new transfer satisfies domain constraints
@@ -98,15 +212,7 @@ func (app *Application) handleTransferCreate() http.HandlerFunc {
 			return
 		}
 
-		apiTransfer := Transfer{
-			ID: transfer.ID(),
-
-			ItineraryID: transfer.ItineraryID(),
-			Status:      transfer.Status(),
-			Progress:    transfer.Progress(),
-			CreatedAt:   transfer.CreatedAt(),
-			UpdatedAt:   transfer.UpdatedAt(),
-		}
+		apiTransfer := toTransfer(transfer)
 		resp := response{
 			Transfer: apiTransfer,
 		}
@@ -137,15 +243,7 @@ func (app *Application) handleTransferList() http.HandlerFunc {
 		// use make here to encode JSON as "[]" instead of "null" if empty
 		apiTransfers := make([]Transfer, 0)
 		for _, transfer := range transfers {
-			apiTransfer := Transfer{
-				ID: transfer.ID(),
-
-				ItineraryID: transfer.ItineraryID(),
-				Status:      transfer.Status(),
-				Progress:    transfer.Progress(),
-				CreatedAt:   transfer.CreatedAt(),
-				UpdatedAt:   transfer.UpdatedAt(),
-			}
+			apiTransfer := toTransfer(transfer)
 			apiTransfers = append(apiTransfers, apiTransfer)
 		}
 
@@ -163,7 +261,8 @@ func (app *Application) handleTransferList() http.HandlerFunc {
 
 func (app *Application) handleTransferRead() http.HandlerFunc {
 	type response struct {
-		Transfer Transfer `json:"transfer"`
+		Transfer Transfer   `json:"transfer"`
+		Reruns   []Transfer `json:"reruns"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -185,17 +284,22 @@ func (app *Application) handleTransferRead() http.HandlerFunc {
 			return
 		}
 
-		apiTransfer := Transfer{
-			ID: transfer.ID(),
+		reruns, err := app.repo.Transfer.ListReruns(transfer)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 
-			ItineraryID: transfer.ItineraryID(),
-			Status:      transfer.Status(),
-			Progress:    transfer.Progress(),
-			CreatedAt:   transfer.CreatedAt(),
-			UpdatedAt:   transfer.UpdatedAt(),
+		// use make here to encode JSON as "[]" instead of "null" if empty
+		apiReruns := make([]Transfer, 0)
+		for _, rerun := range reruns {
+			apiReruns = append(apiReruns, toTransfer(rerun))
 		}
+
+		apiTransfer := toTransfer(transfer)
 		resp := response{
 			Transfer: apiTransfer,
+			Reruns:   apiReruns,
 		}
 
 		err = writeJSON(w, http.StatusOK, resp, nil)
@@ -205,3 +309,235 @@ func (app *Application) handleTransferRead() http.HandlerFunc {
 		}
 	}
 }
+
+func (app *Application) handleTransferCancel() http.HandlerFunc {
+	type response struct {
+		Transfer Transfer `json:"transfer"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		transfer, err := app.repo.Transfer.Read(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		err = transfer.Cancel()
+		if err != nil {
+			switch {
+			case errors.Is(err, domain.ErrTransferFinished):
+				app.conflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		err = app.repo.Transfer.Cancel(transfer)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrConflict):
+				app.conflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		// running transfers are stopped by their worker shortly
+		status := http.StatusOK
+		if transfer.Status() == domain.TransferStatusRunning {
+			status = http.StatusAccepted
+		} else {
+			event, err := domain.NewTransferEvent(transfer, domain.TransferEventCanceled, "canceled while queued")
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			err = app.repo.TransferEvent.Create(event)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		resp := response{
+			Transfer: toTransfer(transfer),
+		}
+
+		err = writeJSON(w, status, resp, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
+
+func (app *Application) handleTransferRerun() http.HandlerFunc {
+	type response struct {
+		Transfer Transfer `json:"transfer"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		transfer, itinerary, ok := app.readTransferItinerary(w, r)
+		if !ok {
+			return
+		}
+
+		rerun, err := transfer.Rerun(itinerary)
+		if err != nil {
+			switch {
+			case errors.Is(err, domain.ErrTransferNotFinished):
+				app.conflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		app.createChildTransfer(w, r, rerun)
+	}
+}
+
+func (app *Application) handleTransferRetryFailed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+
+		transfer, itinerary, ok := app.readTransferItinerary(w, r)
+		if !ok {
+			return
+		}
+
+		// the files that the original transfer set out to copy (or, if it
+		// copied whatever matched, whatever matches now)
+		candidates := transfer.Files()
+		if candidates == nil {
+			fromLocation, err := app.repo.Location.Read(itinerary.FromLocationID())
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			from, err := fromLocation.Connect()
+			if err != nil {
+				app.fileServerErrorResponse(w, r, err)
+				return
+			}
+
+			files, err := from.Search(itinerary.Pattern())
+			if err != nil {
+				app.fileServerErrorResponse(w, r, err)
+				return
+			}
+
+			for _, file := range files {
+				candidates = append(candidates, file.Name)
+			}
+		}
+
+		retry, err := transfer.RetryFailed(itinerary, candidates)
+		if err != nil {
+			switch {
+			case errors.Is(err, domain.ErrTransferNotFailed):
+				app.conflictResponse(w, r)
+				return
+			case errors.Is(err, domain.ErrTransferNoFailures):
+				v.AddError("transfer", err.Error())
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		// ensure there is something left to retry
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.createChildTransfer(w, r, retry)
+	}
+}
+
+// Look up the transfer named in the URL along with its itinerary.
+func (app *Application) readTransferItinerary(w http.ResponseWriter, r *http.Request) (*domain.Transfer, *domain.Itinerary, bool) {
+	id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	transfer, err := app.repo.Transfer.Read(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotExist):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return nil, nil, false
+	}
+
+	itinerary, err := app.repo.Itinerary.Read(transfer.ItineraryID())
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotExist):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return nil, nil, false
+	}
+
+	return transfer, itinerary, true
+}
+
+// Save a rerun (or retry) and respond with it.
+func (app *Application) createChildTransfer(w http.ResponseWriter, r *http.Request, transfer *domain.Transfer) {
+	type response struct {
+		Transfer Transfer `json:"transfer"`
+	}
+
+	err := app.repo.Transfer.Create(transfer)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrConflict):
+			app.conflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	resp := response{
+		Transfer: toTransfer(transfer),
+	}
+
+	header := make(http.Header)
+	header.Set("Location", fmt.Sprintf("/api/v1/transfer/%s", transfer.ID()))
+
+	err = writeJSON(w, http.StatusCreated, resp, header)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
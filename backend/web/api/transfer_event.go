@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/alexedwards/flow"
+	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/repository"
+	"github.com/theandrew168/dripfile/backend/validator"
+)
+
+type TransferEvent struct {
+	ID uuid.UUID `json:"id"`
+
+	TransferID uuid.UUID                `json:"transferID"`
+	Kind       domain.TransferEventKind `json:"kind"`
+	WorkerID   string                   `json:"workerID,omitempty"`
+	File       string                   `json:"file,omitempty"`
+	Message    string                   `json:"message,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func toTransferEvent(event *domain.TransferEvent) TransferEvent {
+	return TransferEvent{
+		ID: event.ID(),
+
+		TransferID: event.TransferID(),
+		Kind:       event.Kind(),
+		WorkerID:   event.WorkerID(),
+		File:       event.File(),
+		Message:    event.Message(),
+
+		CreatedAt: event.CreatedAt(),
+	}
+}
+
+func (app *Application) handleTransferEventList() http.HandlerFunc {
+	type response struct {
+		Events   []TransferEvent `json:"events"`
+		Metadata Metadata        `json:"metadata"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+
+		id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		page := readPage(r.URL.Query(), v)
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		transfer, err := app.repo.Transfer.Read(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		events, total, err := app.repo.TransferEvent.List(transfer, page.Limit(), page.Offset())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// use make here to encode JSON as "[]" instead of "null" if empty
+		apiEvents := make([]TransferEvent, 0)
+		for _, event := range events {
+			apiEvents = append(apiEvents, toTransferEvent(event))
+		}
+
+		resp := response{
+			Events:   apiEvents,
+			Metadata: toMetadata(page, total),
+		}
+
+		err = writeJSON(w, http.StatusOK, resp, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/alexedwards/flow"
+	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/repository"
+	"github.com/theandrew168/dripfile/backend/validator"
+)
+
+type TransferFile struct {
+	ID uuid.UUID `json:"id"`
+
+	TransferID uuid.UUID                 `json:"transferID"`
+	Name       string                    `json:"name"`
+	Dest       string                    `json:"dest"`
+	Size       int                       `json:"size"`
+	Checksum   string                    `json:"checksum,omitempty"`
+	Status     domain.TransferFileStatus `json:"status"`
+	Error      string                    `json:"error,omitempty"`
+	Attempts   int                       `json:"attempts"`
+
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+func toTransferFile(file *domain.TransferFile) TransferFile {
+	return TransferFile{
+		ID: file.ID(),
+
+		TransferID: file.TransferID(),
+		Name:       file.Name(),
+		Dest:       file.Dest(),
+		Size:       file.Size(),
+		Checksum:   file.Checksum(),
+		Status:     file.Status(),
+		Error:      file.Error(),
+		Attempts:   file.Attempts(),
+
+		StartedAt:  file.StartedAt(),
+		FinishedAt: file.FinishedAt(),
+	}
+}
+
+func (app *Application) handleTransferFileList() http.HandlerFunc {
+	type response struct {
+		Files    []TransferFile `json:"files"`
+		Metadata Metadata       `json:"metadata"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+
+		id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		page := readPage(r.URL.Query(), v)
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		transfer, err := app.repo.Transfer.Read(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		files, total, err := app.repo.TransferFile.List(transfer, page.Limit(), page.Offset())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// use make here to encode JSON as "[]" instead of "null" if empty
+		apiFiles := make([]TransferFile, 0)
+		for _, file := range files {
+			apiFiles = append(apiFiles, toTransferFile(file))
+		}
+
+		resp := response{
+			Files:    apiFiles,
+			Metadata: toMetadata(page, total),
+		}
+
+		err = writeJSON(w, http.StatusOK, resp, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
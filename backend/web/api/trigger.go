@@ -0,0 +1,334 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alexedwards/flow"
+	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/repository"
+	"github.com/theandrew168/dripfile/backend/validator"
+)
+
+// Header containing the hex-encoded HMAC-SHA256 signature of a webhook body.
+const TriggerSignatureHeader = "X-Dripfile-Signature"
+
+type Trigger struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// Body of a webhook trigger. This covers both the native format (an optional
+// event ID and list of files) and MinIO's bucket notification format.
+type triggerRequest struct {
+	EventID string   `json:"eventID"`
+	Files   []string `json:"files"`
+
+	// https://min.io/docs/minio/linux/administration/monitoring/publish-events-to-webhook.html
+	EventName string          `json:"EventName"`
+	Key       string          `json:"Key"`
+	Records   []triggerRecord `json:"Records"`
+}
+
+type triggerRecord struct {
+	EventName string `json:"eventName"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key       string `json:"key"`
+			Sequencer string `json:"sequencer"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+func (app *Application) handleTriggerSecretRotate() http.HandlerFunc {
+	type response struct {
+		Trigger Trigger `json:"trigger"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		itinerary, err := app.repo.Itinerary.Read(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		secret, err := itinerary.RotateTriggerSecret()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.repo.Itinerary.Update(itinerary)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrConflict):
+				app.conflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		// the secret is only ever revealed here (rotate again if it gets lost)
+		resp := response{
+			Trigger: Trigger{
+				URL:    fmt.Sprintf("/api/v1/itinerary/%s/trigger", itinerary.ID()),
+				Secret: secret,
+			},
+		}
+
+		err = writeJSON(w, http.StatusOK, resp, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
+
+func (app *Application) handleTriggerSecretDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		itinerary, err := app.repo.Itinerary.Read(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		err = itinerary.DisableTrigger()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.repo.Itinerary.Update(itinerary)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrConflict):
+				app.conflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (app *Application) handleTrigger() http.HandlerFunc {
+	type response struct {
+		Transfer Transfer `json:"transfer"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+
+		id, err := uuid.Parse(flow.Param(r.Context(), "id"))
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		itinerary, err := app.repo.Itinerary.Read(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		// itineraries without a secret can't be triggered
+		if itinerary.TriggerSecret() == "" {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		// the raw body is needed to verify signatures
+		body, err := io.ReadAll(readBody(w, r))
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if !authorizeTrigger(itinerary, r, body) {
+			app.unauthorizedResponse(w, r)
+			return
+		}
+
+		// an empty body triggers a transfer of all matching files
+		var req triggerRequest
+		if len(bytes.TrimSpace(body)) > 0 {
+			err = readJSON(bytes.NewReader(body), &req, false)
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+		}
+
+		eventID := req.EventID
+		files := req.Files
+
+		// bucket notifications only trigger transfers of newly-created objects
+		if len(req.Records) > 0 {
+			files, eventID = minioTriggerFiles(req.Records)
+			if len(files) == 0 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if req.EventID != "" {
+				eventID = req.EventID
+			}
+		}
+
+		// an explicit idempotency key takes precedence over the body
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			eventID = key
+		}
+
+		for _, file := range files {
+			v.Check(file != "", "files", "must not contain empty names")
+			v.Check(validator.FileName(file), "files", "must only contain relative file names")
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		transfer, err := itinerary.NewTriggeredTransfer(eventID, files)
+		if err != nil {
+			v.AddError("transfer", err.Error())
+		}
+
+		// ensure new transfer satisfies domain constraints
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		status := http.StatusAccepted
+		err = app.repo.Transfer.Create(transfer)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrConflict) && transfer.IdempotencyKey() != "":
+				// this event was already delivered: respond with the original transfer
+				transfer, err = app.repo.Transfer.ReadByIdempotencyKey(transfer.IdempotencyKey())
+				if err != nil {
+					app.serverErrorResponse(w, r, err)
+					return
+				}
+
+				status = http.StatusOK
+			case errors.Is(err, repository.ErrConflict):
+				app.conflictResponse(w, r)
+				return
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		resp := response{
+			Transfer: toTransfer(transfer),
+		}
+
+		header := make(http.Header)
+		header.Set("Location", fmt.Sprintf("/api/v1/transfer/%s", transfer.ID()))
+
+		err = writeJSON(w, status, resp, header)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+}
+
+// Webhooks authenticate by either signing the body with the trigger secret or
+// by including the secret itself as a bearer token (or "token" query param).
+func authorizeTrigger(itinerary *domain.Itinerary, r *http.Request, body []byte) bool {
+	signature := r.Header.Get(TriggerSignatureHeader)
+	if signature != "" {
+		return itinerary.VerifyTriggerSignature(body, signature)
+	}
+
+	// MinIO sends the configured auth_token as-is (with or without "Bearer")
+	token := r.Header.Get("Authorization")
+	token = strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+
+	return itinerary.VerifyTriggerToken(token)
+}
+
+// Determine which files were created by a MinIO bucket notification. The
+// event ID is a hash of each object's key and sequencer (which are unique per
+// change) so that redelivered notifications don't enqueue duplicates. Hashing
+// keeps the ID short no matter how many records a notification holds.
+func minioTriggerFiles(records []triggerRecord) ([]string, string) {
+	var files []string
+	var events []string
+	for _, record := range records {
+		if !strings.HasPrefix(record.EventName, "s3:ObjectCreated:") {
+			continue
+		}
+
+		// object keys are URL-encoded within notifications
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			key = record.S3.Object.Key
+		}
+
+		files = append(files, key)
+		events = append(events, key+"@"+record.S3.Object.Sequencer)
+	}
+
+	if len(events) == 0 {
+		return files, ""
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(events, ",")))
+	return files, hex.EncodeToString(sum[:])
+}
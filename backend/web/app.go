@@ -10,6 +10,7 @@ import (
 	"github.com/klauspost/compress/gzhttp"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/theandrew168/dripfile/backend/database"
 	"github.com/theandrew168/dripfile/backend/repository"
 	"github.com/theandrew168/dripfile/backend/web/api"
 	"github.com/theandrew168/dripfile/backend/web/middleware"
@@ -20,12 +21,22 @@ type Application struct {
 	public fs.FS
 
 	repo *repository.Repository
+
+	// drives live transfer updates (nil to not send any)
+	listener *database.Listener
+	broker   *api.Broker
+
+	maxUploadBytes    int
+	allowedLocalRoots []string
 }
 
 func NewApplication(
 	logger *slog.Logger,
 	distFS fs.FS,
 	repo *repository.Repository,
+	listener *database.Listener,
+	maxUploadBytes int,
+	allowedLocalRoots []string,
 ) *Application {
 	var public fs.FS
 	if os.Getenv("DEBUG") != "" {
@@ -41,6 +52,12 @@ func NewApplication(
 		logger: logger,
 		public: public,
 		repo:   repo,
+
+		listener: listener,
+		broker:   api.NewBroker(logger),
+
+		maxUploadBytes:    maxUploadBytes,
+		allowedLocalRoots: allowedLocalRoots,
 	}
 	return &app
 }
@@ -62,6 +79,9 @@ func (app *Application) Handler() http.Handler {
 	apiV1 := api.NewApplication(
 		app.logger,
 		app.repo,
+		app.broker,
+		app.maxUploadBytes,
+		app.allowedLocalRoots,
 	)
 	mux.Handle("/api/v1/...", http.StripPrefix("/api/v1", apiV1.Handler()))
 	mux.HandleFunc("/api/v1", func(w http.ResponseWriter, r *http.Request) {
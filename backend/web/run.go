@@ -3,11 +3,14 @@ package web
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
 	"time"
 )
 
-func (app *Application) Run(ctx context.Context, addr string) error {
+// Serve until the context is done. Ready is called once the server is
+// listening for requests.
+func (app *Application) Run(ctx context.Context, addr string, ready func()) error {
 	srv := http.Server{
 		Addr:    addr,
 		Handler: app.Handler(),
@@ -17,6 +20,29 @@ func (app *Application) Run(ctx context.Context, addr string) error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// end any open streams so that they don't hold up a graceful shutdown
+	srv.RegisterOnShutdown(app.broker.Close)
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	// pass along transfer updates from any process to open streams
+	listening := make(chan struct{})
+	if app.listener != nil {
+		go func() {
+			defer close(listening)
+
+			err := app.listener.Run(ctx, app.broker.Publish)
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+		}()
+	} else {
+		close(listening)
+	}
+
 	// start a goro to watch for stop signal (context cancelled)
 	stopError := make(chan error)
 	go func() {
@@ -38,10 +64,11 @@ func (app *Application) Run(ctx context.Context, addr string) error {
 	}()
 
 	app.logger.Info("starting web server", "addr", srv.Addr)
+	ready()
 
-	// listen and serve forever
+	// serve forever
 	// ignore http.ErrServerClosed (expected upon stop)
-	err := srv.ListenAndServe()
+	err = srv.Serve(l)
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -52,6 +79,8 @@ func (app *Application) Run(ctx context.Context, addr string) error {
 		return err
 	}
 
+	<-listening
+
 	app.logger.Info("stopped web server")
 	return nil
 }
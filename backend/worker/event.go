@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/repository"
+)
+
+// Identify this process (and the host that it runs on) in transfer events.
+func hostID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// Append an event to a transfer's timeline. Events are only there to explain
+// what happened so failing to save one is logged rather than returned.
+func recordEvent(
+	logger *slog.Logger,
+	repo *repository.Repository,
+	transfer *domain.Transfer,
+	workerID string,
+	kind domain.TransferEventKind,
+	file string,
+	message string,
+) {
+	event, err := domain.NewTransferEvent(transfer, kind, message)
+	if err != nil {
+		logger.Error(err.Error(), "id", transfer.ID())
+		return
+	}
+
+	event.SetWorkerID(workerID)
+	event.SetFile(file)
+
+	err = repo.TransferEvent.Create(event)
+	if err != nil {
+		logger.Error(err.Error(), "id", transfer.ID(), "kind", kind)
+	}
+}
+
+// Describe how a run of a transfer ended given the status that it was left
+// in and the reason that it stopped (if any).
+func outcomeEvent(transfer *domain.Transfer, reason error) (domain.TransferEventKind, string) {
+	switch transfer.Status() {
+	case domain.TransferStatusPending, domain.TransferStatusRetrying:
+		// the transfer will run again (here or elsewhere)
+		var message string
+		if reason != nil {
+			message = reason.Error()
+		}
+		return domain.TransferEventRetried, message
+	case domain.TransferStatusCanceled:
+		return domain.TransferEventCanceled, ""
+	default:
+		message := string(transfer.Status())
+		if transfer.Error() != "" {
+			message += ": " + transfer.Error()
+		}
+		return domain.TransferEventFinished, message
+	}
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Minimal HTTP listener for worker-only processes (which don't serve the web
+// app) so that they can still be health checked and scraped for metrics.
+type HealthServer struct {
+	logger *slog.Logger
+}
+
+func NewHealthServer(logger *slog.Logger) *HealthServer {
+	s := HealthServer{
+		logger: logger,
+	}
+	return &s
+}
+
+func (s *HealthServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	// healthcheck endpoint
+	mux.HandleFunc("GET /ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("pong\n"))
+	})
+
+	// prometheus metrics
+	mux.Handle("GET /metrics", promhttp.Handler())
+
+	return mux
+}
+
+// Serve until the context is done. Ready is called once the server is
+// listening for requests.
+func (s *HealthServer) Run(ctx context.Context, addr string, ready func()) error {
+	srv := http.Server{
+		Addr:    addr,
+		Handler: s.Handler(),
+
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	// start a goro to watch for stop signal (context cancelled)
+	stopError := make(chan error)
+	go func() {
+		<-ctx.Done()
+
+		// give the health server 5 seconds to shutdown gracefully
+		timeout, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		s.logger.Info("stopping health server")
+		err := srv.Shutdown(timeout)
+		if err != nil {
+			stopError <- err
+		}
+
+		close(stopError)
+	}()
+
+	s.logger.Info("starting health server", "addr", srv.Addr)
+	ready()
+
+	// ignore http.ErrServerClosed (expected upon stop)
+	err = srv.Serve(l)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// check for errors that arose while stopping
+	err = <-stopError
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("stopped health server")
+	return nil
+}
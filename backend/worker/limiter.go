@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+	"golang.org/x/time/rate"
+
+	"github.com/theandrew168/dripfile/backend/fileserver"
+)
+
+// Bandwidth limiters are shared by every transfer that touches the same
+// itinerary or location so that concurrent copies split the configured cap.
+// They only live in this process, so N workers allow up to N times the cap.
+type limiterSet struct {
+	mu       sync.Mutex
+	limiters map[uuid.UUID]*rate.Limiter
+}
+
+func newLimiterSet() *limiterSet {
+	s := limiterSet{
+		limiters: make(map[uuid.UUID]*rate.Limiter),
+	}
+	return &s
+}
+
+// Get (or create) the limiter for a given ID, keeping its rate in sync with the
+// latest configured value. A non-positive rate means unlimited (nil limiter).
+func (s *limiterSet) Get(id uuid.UUID, bytesPerSecond int) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if bytesPerSecond <= 0 {
+		delete(s.limiters, id)
+		return nil
+	}
+
+	limiter, ok := s.limiters[id]
+	if !ok {
+		limiter = fileserver.NewLimiter(bytesPerSecond)
+		s.limiters[id] = limiter
+		return limiter
+	}
+
+	if limiter.Burst() != bytesPerSecond {
+		limiter.SetLimit(rate.Limit(bytesPerSecond))
+		limiter.SetBurst(bytesPerSecond)
+	}
+
+	return limiter
+}
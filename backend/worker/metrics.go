@@ -0,0 +1,21 @@
+package worker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	transferSlots = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dripfile_worker_transfer_slots",
+		Help: "Number of transfers that the worker can run at once.",
+	})
+	transfersRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dripfile_worker_transfers_running",
+		Help: "Number of transfers that the worker is currently running.",
+	})
+	transfersProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dripfile_worker_transfers_processed_total",
+		Help: "Number of transfers that the worker has run, by resulting status.",
+	}, []string{"status"})
+)
@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/repository"
+)
+
+// How often to check for itineraries that are due to be polled.
+const pollerInterval = 5 * time.Second
+
+// Polls the source location of itineraries that opt into it and enqueues a
+// transfer whenever files show up that haven't been seen before.
+type Poller struct {
+	logger *slog.Logger
+	repo   *repository.Repository
+}
+
+func NewPoller(logger *slog.Logger, repo *repository.Repository) *Poller {
+	p := Poller{
+		logger: logger,
+		repo:   repo,
+	}
+	return &p
+}
+
+func (p *Poller) Run(ctx context.Context) error {
+	p.logger.Info("starting poller")
+
+	// do an initial poll before starting the ticker
+	err := p.Poll()
+	if err != nil {
+		// log error but don't abort
+		p.logger.Error(err.Error())
+	}
+
+	ticker := time.NewTicker(pollerInterval)
+	defer ticker.Stop()
+
+	running := true
+	for running {
+		select {
+		case <-ticker.C:
+			err := p.Poll()
+			if err != nil {
+				// log error but don't abort
+				p.logger.Error(err.Error())
+			}
+		case <-ctx.Done():
+			running = false
+		}
+	}
+
+	p.logger.Info("stopped poller")
+
+	return nil
+}
+
+// Check the source of every itinerary that is due to be polled.
+func (p *Poller) Poll() error {
+	for {
+		itinerary, err := p.repo.Itinerary.AcquirePoll()
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrNotExist):
+				return nil
+			default:
+				return err
+			}
+		}
+
+		err = p.check(itinerary)
+		if err != nil {
+			// log error but keep going with the other itineraries
+			p.logger.Error(err.Error(), "itinerary_id", itinerary.ID())
+		}
+	}
+}
+
+func (p *Poller) check(itinerary *domain.Itinerary) error {
+	fromLocation, err := p.repo.Location.Read(itinerary.FromLocationID())
+	if err != nil {
+		return err
+	}
+
+	from, err := fromLocation.Connect()
+	if err != nil {
+		return err
+	}
+
+	files, err := from.Search(itinerary.Pattern())
+	if err != nil {
+		return err
+	}
+
+	// data files that are still waiting on their markers aren't seen yet (so
+	// that they get picked up once the marker shows up)
+	files, err = itinerary.Marker().Ready(from, files)
+	if err != nil {
+		return err
+	}
+
+	unseen, err := p.repo.Itinerary.ListUnseen(itinerary, files)
+	if err != nil {
+		return err
+	}
+
+	// enqueue before marking files as seen so that a crash in between leads
+	// to an extra transfer instead of a missed one
+	if len(unseen) > 0 {
+		transfer, err := domain.NewTransfer(itinerary)
+		if err != nil {
+			return err
+		}
+
+		key := fmt.Sprintf("poll:%s:%d", itinerary.ID(), itinerary.PolledAt().UnixNano())
+		transfer.SetIdempotencyKey(key)
+
+		// only copy the new files (the rest were handled by earlier transfers)
+		var names []string
+		for _, file := range unseen {
+			names = append(names, file.Name)
+		}
+		transfer.SetFiles(names)
+
+		err = p.repo.Transfer.Create(transfer)
+		if err != nil && !errors.Is(err, repository.ErrConflict) {
+			return err
+		}
+
+		p.logger.Info("polled transfer",
+			"id", transfer.ID(),
+			"itinerary_id", itinerary.ID(),
+			"new_files", len(unseen),
+		)
+	}
+
+	return p.repo.Itinerary.MarkSeen(itinerary, files)
+}
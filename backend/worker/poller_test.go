@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/repository"
+	"github.com/theandrew168/dripfile/backend/test"
+)
+
+func TestPollerMarkerArrivesLater(t *testing.T) {
+	t.Parallel()
+
+	repo, closer := test.Repository(t)
+	defer closer()
+
+	root := t.TempDir()
+	from, err := domain.NewLocalLocation(root, []string{root})
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(from)
+	test.AssertNilError(t, err)
+
+	to, err := domain.NewMemoryLocation()
+	test.AssertNilError(t, err)
+
+	err = repo.Location.Create(to)
+	test.AssertNilError(t, err)
+
+	itinerary, err := domain.NewItinerary(from, to, "*")
+	test.AssertNilError(t, err)
+
+	err = itinerary.SetMarker(fileserver.MarkerPolicy{
+		Suffix: ".done",
+		Action: fileserver.MarkerActionKeep,
+	})
+	test.AssertNilError(t, err)
+
+	err = repo.Itinerary.Create(itinerary)
+	test.AssertNilError(t, err)
+
+	poller := NewPoller(slog.New(slog.NewTextHandler(io.Discard, nil)), repo)
+
+	// the data file shows up on its own
+	err = os.WriteFile(filepath.Join(root, "report.csv"), []byte("a,b,c"), 0644)
+	test.AssertNilError(t, err)
+
+	err = poller.check(itinerary)
+	test.AssertNilError(t, err)
+
+	// nothing is enqueued until the marker shows up
+	key := fmt.Sprintf("poll:%s:%d", itinerary.ID(), itinerary.PolledAt().UnixNano())
+	_, err = repo.Transfer.ReadByIdempotencyKey(key)
+	test.AssertErrorIs(t, err, repository.ErrNotExist)
+
+	// and then it arrives in a later poll
+	err = os.WriteFile(filepath.Join(root, "report.csv.done"), nil, 0644)
+	test.AssertNilError(t, err)
+
+	err = poller.check(itinerary)
+	test.AssertNilError(t, err)
+
+	transfer, err := repo.Transfer.ReadByIdempotencyKey(key)
+	test.AssertNilError(t, err)
+	test.AssertSliceContains(t, transfer.Files(), "report.csv")
+}
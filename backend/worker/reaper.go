@@ -0,0 +1,98 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/theandrew168/dripfile/backend/repository"
+)
+
+// How often to check for running transfers with an expired lease.
+const reaperInterval = 30 * time.Second
+
+// Why a reaped transfer stopped (matches the error that the reaper saves).
+var errLeaseExpired = errors.New("worker stopped responding")
+
+// Recovers transfers that are stuck in running because their worker died (or
+// was redeployed) without finishing them. Any number of reapers can run at
+// once (across processes) since each expired lease is only reaped once.
+type Reaper struct {
+	logger *slog.Logger
+	repo   *repository.Repository
+}
+
+func NewReaper(logger *slog.Logger, repo *repository.Repository) *Reaper {
+	r := Reaper{
+		logger: logger,
+		repo:   repo,
+	}
+	return &r
+}
+
+func (r *Reaper) Run(ctx context.Context) error {
+	r.logger.Info("starting reaper")
+
+	// do an initial reap before starting the ticker
+	err := r.Reap()
+	if err != nil {
+		// log error but don't abort
+		r.logger.Error(err.Error())
+	}
+
+	ticker := time.NewTicker(reaperInterval)
+	defer ticker.Stop()
+
+	running := true
+	for running {
+		select {
+		case <-ticker.C:
+			err := r.Reap()
+			if err != nil {
+				// log error but don't abort
+				r.logger.Error(err.Error())
+			}
+		case <-ctx.Done():
+			running = false
+		}
+	}
+
+	r.logger.Info("stopped reaper")
+
+	return nil
+}
+
+// Return expired transfers to the queue (or give up on them).
+func (r *Reaper) Reap() error {
+	transfers, err := r.repo.Transfer.ReapExpired()
+	if err != nil {
+		return err
+	}
+
+	for _, transfer := range transfers {
+		r.logger.Warn("reaped transfer", "id", transfer.ID(), "status", transfer.Status())
+
+		kind, message := outcomeEvent(transfer, errLeaseExpired)
+		recordEvent(r.logger, r.repo, transfer, "", kind, "", message)
+
+		// a finished transfer will never resume its partial upload
+		if !transfer.Finished() || transfer.Partial() == nil {
+			continue
+		}
+
+		err := abortPartial(r.repo, transfer)
+		if err != nil {
+			// log error but keep going with the other transfers
+			r.logger.Error(err.Error(), "id", transfer.ID())
+		}
+
+		transfer.SetPartial(nil)
+		err = r.repo.Transfer.Update(transfer)
+		if err != nil {
+			r.logger.Error(err.Error(), "id", transfer.ID())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/repository"
+)
+
+// How often to check for schedules with a due tick.
+const schedulerInterval = 10 * time.Second
+
+// Enqueues transfers for linked itineraries whenever a schedule's tick comes
+// due. Any number of schedulers can run at once (across processes): each tick
+// is only enqueued once thanks to the transfer's idempotency key and the
+// schedule's optimistic update.
+type Scheduler struct {
+	logger *slog.Logger
+	repo   *repository.Repository
+}
+
+func NewScheduler(logger *slog.Logger, repo *repository.Repository) *Scheduler {
+	s := Scheduler{
+		logger: logger,
+		repo:   repo,
+	}
+	return &s
+}
+
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.logger.Info("starting scheduler")
+
+	// do an initial check before starting the ticker
+	err := s.Tick(time.Now())
+	if err != nil {
+		// log error but don't abort
+		s.logger.Error(err.Error())
+	}
+
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	running := true
+	for running {
+		select {
+		case <-ticker.C:
+			err := s.Tick(time.Now())
+			if err != nil {
+				// log error but don't abort
+				s.logger.Error(err.Error())
+			}
+		case <-ctx.Done():
+			running = false
+		}
+	}
+
+	s.logger.Info("stopped scheduler")
+
+	return nil
+}
+
+// Enqueue transfers for every schedule that is due as of a given time.
+func (s *Scheduler) Tick(now time.Time) error {
+	schedules, err := s.repo.Schedule.ListDue(now)
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		err := s.enqueue(schedule, now)
+		if err != nil {
+			// log error but keep going with the other schedules
+			s.logger.Error(err.Error(), "schedule_id", schedule.ID())
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) enqueue(schedule *domain.Schedule, now time.Time) error {
+	tick := schedule.NextRunAt()
+
+	// create the transfers before advancing the schedule so that a crash in
+	// between results in a (deduplicated) retry rather than a missed tick
+	for _, itineraryID := range schedule.ItineraryIDs() {
+		itinerary, err := s.repo.Itinerary.Read(itineraryID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+
+		transfer, err := schedule.NewTransfer(itinerary, tick)
+		if err != nil {
+			return err
+		}
+
+		err = s.repo.Transfer.Create(transfer)
+		if err != nil {
+			// another scheduler already enqueued this tick
+			if errors.Is(err, repository.ErrConflict) {
+				continue
+			}
+			return err
+		}
+
+		s.logger.Info("scheduled transfer",
+			"id", transfer.ID(),
+			"schedule_id", schedule.ID(),
+			"itinerary_id", itinerary.ID(),
+			"tick", tick,
+		)
+	}
+
+	err := schedule.Advance(now)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.Schedule.Update(schedule)
+	if err != nil {
+		// another scheduler already advanced this schedule
+		if errors.Is(err, repository.ErrConflict) {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
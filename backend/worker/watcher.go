@@ -0,0 +1,248 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/theandrew168/dripfile/backend/domain"
+	"github.com/theandrew168/dripfile/backend/fileserver"
+	"github.com/theandrew168/dripfile/backend/repository"
+)
+
+// How often to check for local directories that need to be (un)watched.
+const watcherRefreshInterval = 30 * time.Second
+
+// Watches the local directories that are the source of at least one itinerary
+// and enqueues a transfer as soon as new files have settled.
+type Watcher struct {
+	logger *slog.Logger
+	repo   *repository.Repository
+
+	wg      sync.WaitGroup
+	watches map[uuid.UUID]*watch
+}
+
+// A single running directory watch.
+type watch struct {
+	info   any
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewWatcher(logger *slog.Logger, repo *repository.Repository) *Watcher {
+	w := Watcher{
+		logger:  logger,
+		repo:    repo,
+		watches: make(map[uuid.UUID]*watch),
+	}
+	return &w
+}
+
+func (w *Watcher) Run(ctx context.Context) error {
+	w.logger.Info("starting watcher")
+
+	// do an initial refresh before starting the ticker
+	err := w.refresh(ctx)
+	if err != nil {
+		// log error but don't abort
+		w.logger.Error(err.Error())
+	}
+
+	ticker := time.NewTicker(watcherRefreshInterval)
+	defer ticker.Stop()
+
+	running := true
+	for running {
+		select {
+		case <-ticker.C:
+			err := w.refresh(ctx)
+			if err != nil {
+				// log error but don't abort
+				w.logger.Error(err.Error())
+			}
+		case <-ctx.Done():
+			running = false
+		}
+	}
+
+	// the context is done so just wait for each watch to stop
+	w.wg.Wait()
+
+	w.logger.Info("stopped watcher")
+
+	return nil
+}
+
+// Start watching new source directories and stop watching old ones.
+func (w *Watcher) refresh(ctx context.Context) error {
+	locations, err := w.repo.Location.List()
+	if err != nil {
+		return err
+	}
+
+	itineraries, err := w.repo.Itinerary.List()
+	if err != nil {
+		return err
+	}
+
+	sources := make(map[uuid.UUID]bool)
+	for _, itinerary := range itineraries {
+		sources[itinerary.FromLocationID()] = true
+	}
+
+	wanted := make(map[uuid.UUID]*domain.Location)
+	for _, location := range locations {
+		if location.Kind() == domain.LocationKindLocal && sources[location.ID()] {
+			wanted[location.ID()] = location
+		}
+	}
+
+	// stop watches that are no longer needed (or have changed or died)
+	for id, watch := range w.watches {
+		location, ok := wanted[id]
+		if ok && location.Info() == watch.info && !isDone(watch.done) {
+			continue
+		}
+
+		watch.cancel()
+		<-watch.done
+		delete(w.watches, id)
+	}
+
+	for id, location := range wanted {
+		if _, ok := w.watches[id]; ok {
+			continue
+		}
+
+		err := w.start(ctx, location)
+		if err != nil {
+			// log error but keep going with the other locations
+			w.logger.Error(err.Error(), "location_id", id)
+		}
+	}
+
+	return nil
+}
+
+func (w *Watcher) start(ctx context.Context, location *domain.Location) error {
+	watcher, err := location.Watch()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	watch := watch{
+		info:   location.Info(),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	w.watches[location.ID()] = &watch
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(watch.done)
+
+		w.logger.Info("watching location", "location_id", location.ID())
+
+		err := watcher.Run(ctx, func(files []fileserver.FileInfo) {
+			err := w.enqueue(location, files)
+			if err != nil {
+				w.logger.Error(err.Error(), "location_id", location.ID())
+			}
+		})
+		if err != nil {
+			w.logger.Error(err.Error(), "location_id", location.ID())
+		}
+	}()
+
+	return nil
+}
+
+// Enqueue a transfer for each itinerary that wants any of the settled files.
+func (w *Watcher) enqueue(location *domain.Location, files []fileserver.FileInfo) error {
+	// itineraries are read fresh since they may have changed since the last refresh
+	itineraries, err := w.repo.Itinerary.List()
+	if err != nil {
+		return err
+	}
+
+	for _, itinerary := range itineraries {
+		if itinerary.FromLocationID() != location.ID() {
+			continue
+		}
+
+		// skip files that were already enqueued (such as before a restart)
+		unseen, err := w.repo.Itinerary.ListUnseen(itinerary, files)
+		if err != nil {
+			return err
+		}
+
+		transfer, err := itinerary.NewWatchedTransfer(unseen)
+		if err != nil {
+			if errors.Is(err, domain.ErrItineraryNoMatchingFiles) {
+				continue
+			}
+
+			return err
+		}
+
+		// another worker may have already enqueued these same files
+		created := true
+		err = w.repo.Transfer.Create(transfer)
+		if err != nil {
+			if !errors.Is(err, repository.ErrConflict) {
+				return err
+			}
+			created = false
+		}
+
+		// enqueue before marking files as seen so that a crash in between leads
+		// to an extra transfer instead of a missed one
+		marker := itinerary.Marker()
+		var enqueued []fileserver.FileInfo
+		for _, file := range unseen {
+			name := file.Name
+			if marker.IsMarker(name) {
+				name = marker.DataFor(name)
+			}
+
+			if slices.Contains(transfer.Files(), name) {
+				enqueued = append(enqueued, file)
+			}
+		}
+
+		err = w.repo.Itinerary.AddSeen(itinerary, enqueued)
+		if err != nil {
+			return err
+		}
+
+		// the transfer that was built here was never saved
+		if !created {
+			continue
+		}
+
+		w.logger.Info("watched transfer",
+			"id", transfer.ID(),
+			"itinerary_id", itinerary.ID(),
+			"new_files", len(transfer.Files()),
+		)
+	}
+
+	return nil
+}
+
+func isDone(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
@@ -3,10 +3,15 @@ package worker
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"golang.org/x/time/rate"
+
+	"github.com/theandrew168/dripfile/backend/database"
 	"github.com/theandrew168/dripfile/backend/domain"
 	"github.com/theandrew168/dripfile/backend/fileserver"
 	"github.com/theandrew168/dripfile/backend/repository"
@@ -17,27 +22,110 @@ import (
 // https://webapp.io/blog/postgres-is-the-answer/
 // https://www.2ndquadrant.com/en/blog/what-is-select-skip-locked-for-in-postgresql-9-5/
 
+// How often running transfers check whether they have been canceled.
+const cancelCheckInterval = 2 * time.Second
+
+// How long a worker holds onto a transfer without renewing its lease (and
+// how often the lease is renewed while the transfer runs).
+const (
+	leaseDuration      = 1 * time.Minute
+	leaseRenewInterval = leaseDuration / 3
+)
+
+// The transfer was reaped (and possibly handed to another worker) while it
+// was still running here.
+var errLeaseLost = errors.New("worker: transfer lease lost")
+
+// The worker is shutting down and couldn't wait for the transfer to finish.
+var errShutdown = errors.New("worker: shutting down")
+
 type Worker struct {
 	logger *slog.Logger
 	repo   *repository.Repository
 
-	// sync.WaitGroup for running tasks (upper limit via semaphore?)
+	// identifies this worker in transfer events
+	id string
+
+	// process-wide bandwidth cap (nil if unlimited)
+	limiter *rate.Limiter
+
+	// bandwidth caps shared by transfers of the same itinerary or location
+	itineraryLimiters *limiterSet
+	locationLimiters  *limiterSet
+
+	// semaphore that limits the number of transfers running at once
+	slots chan struct{}
+	// signaled whenever there may be new work that can be started: a slot
+	// freed up or a transfer was created (so that it is picked up quickly)
+	wake chan struct{}
+
+	// wakes the worker when transfers are created (nil to only poll)
+	listener *database.Listener
+
+	// how long to wait for running transfers before canceling them at shutdown
+	shutdownTimeout time.Duration
+
+	// sync.WaitGroup for running transfers
 	wg sync.WaitGroup
 }
 
-func New(logger *slog.Logger, repo *repository.Repository) *Worker {
+func New(
+	logger *slog.Logger,
+	repo *repository.Repository,
+	maxBytesPerSecond int,
+	maxConcurrent int,
+	shutdownTimeout time.Duration,
+	listener *database.Listener,
+) *Worker {
 	w := Worker{
 		logger: logger,
 		repo:   repo,
+
+		id: hostID(),
+
+		limiter: fileserver.NewLimiter(maxBytesPerSecond),
+
+		itineraryLimiters: newLimiterSet(),
+		locationLimiters:  newLimiterSet(),
+
+		slots: make(chan struct{}, max(maxConcurrent, 1)),
+		wake:  make(chan struct{}, 1),
+
+		shutdownTimeout: shutdownTimeout,
+
+		listener: listener,
 	}
 	return &w
 }
 
 func (w *Worker) Run(ctx context.Context) error {
 	w.logger.Info("starting worker")
+	transferSlots.Set(float64(cap(w.slots)))
 
-	// do an initial poll before starting the ticker
-	err := w.Poll()
+	// running transfers outlive ctx so that they get a chance to finish
+	runCtx, cancelRun := context.WithCancelCause(context.Background())
+	defer cancelRun(nil)
+
+	// start new transfers as soon as they are created
+	listening := make(chan struct{})
+	if w.listener != nil {
+		go func() {
+			defer close(listening)
+
+			err := w.listener.Run(ctx, func(string) {
+				w.notify()
+			})
+			if err != nil {
+				w.logger.Error(err.Error())
+			}
+		}()
+	} else {
+		close(listening)
+	}
+
+	// do an initial poll before starting the ticker (which is kept as a
+	// fallback for retries and any missed notifications)
+	err := w.Poll(runCtx)
 	if err != nil {
 		// log error but don't abort
 		w.logger.Error(err.Error())
@@ -50,7 +138,13 @@ func (w *Worker) Run(ctx context.Context) error {
 	for running {
 		select {
 		case <-ticker.C:
-			err := w.Poll()
+			err := w.Poll(runCtx)
+			if err != nil {
+				// log error but don't abort
+				w.logger.Error(err.Error())
+			}
+		case <-w.wake:
+			err := w.Poll(runCtx)
 			if err != nil {
 				// log error but don't abort
 				w.logger.Error(err.Error())
@@ -61,20 +155,44 @@ func (w *Worker) Run(ctx context.Context) error {
 	}
 
 	w.logger.Info("stopping worker")
-	w.wg.Wait()
+	<-listening
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	// give running transfers a chance to finish before interrupting them
+	select {
+	case <-done:
+	case <-time.After(w.shutdownTimeout):
+		w.logger.Info("interrupting running transfers")
+		cancelRun(errShutdown)
+		<-done
+	}
 
 	w.logger.Info("stopped worker")
 
 	return nil
 }
 
-func (w *Worker) Poll() error {
+// Start pending transfers (in the background) until every slot is in use.
+func (w *Worker) Poll(ctx context.Context) error {
 	w.logger.Info("checking for new jobs")
 
-	// kick off all pending transfers
 	for {
-		transfer, err := w.repo.Transfer.Acquire()
+		// only acquire new work once a slot is available
+		select {
+		case w.slots <- struct{}{}:
+		default:
+			return nil
+		}
+
+		transfer, err := w.repo.Transfer.Acquire(leaseDuration)
 		if err != nil {
+			w.release()
+
 			switch {
 			case errors.Is(err, repository.ErrNotExist):
 				return nil
@@ -83,29 +201,171 @@ func (w *Worker) Poll() error {
 			}
 		}
 
-		w.logger.Info("running transfer", "id", transfer.ID())
-		err = w.RunTransfer(transfer)
-		if err != nil {
-			transfer.SetError(err.Error())
-			transfer.SetStatus(domain.TransferStatusFailure)
-		} else {
-			transfer.SetStatus(domain.TransferStatusSuccess)
+		w.event(transfer, domain.TransferEventAcquired, "", fmt.Sprintf("attempt %d", transfer.Attempts()))
+
+		w.wg.Add(1)
+		transfersRunning.Inc()
+		go func() {
+			defer w.wg.Done()
+			defer w.release()
+			defer transfersRunning.Dec()
+
+			err := w.process(ctx, transfer)
+			if err != nil {
+				w.logger.Error(err.Error(), "id", transfer.ID())
+			}
+		}()
+	}
+}
+
+// Give a slot back and wake up the poll loop.
+func (w *Worker) release() {
+	<-w.slots
+	w.notify()
+}
+
+// Wake up the poll loop (unless it has already been woken).
+func (w *Worker) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run an acquired transfer and record how it went.
+func (w *Worker) process(ctx context.Context, transfer *domain.Transfer) error {
+	w.logger.Info("running transfer", "id", transfer.ID(), "attempt", transfer.Attempts())
+	err := w.RunTransfer(ctx, transfer)
+	switch {
+	case errors.Is(err, errLeaseLost), errors.Is(err, repository.ErrConflict):
+		// the transfer now belongs to the reaper so leave it be
+		w.logger.Warn("lost transfer lease", "id", transfer.ID())
+		return nil
+	case errors.Is(err, domain.ErrTransferTimeout), errors.Is(err, fileserver.ErrIdleTimeout):
+		// note which file (if any) was being copied when time ran out
+		var stuckOn string
+		var fileErr *fileserver.FileError
+		if errors.As(err, &fileErr) {
+			stuckOn = fileErr.Name
 		}
 
-		err = w.repo.Transfer.Update(transfer)
+		transfer.TimeOut(stuckOn, err)
+		w.logger.Info("timed out transfer", "id", transfer.ID(), "stuck_on", stuckOn)
+	case errors.Is(err, errShutdown):
+		// hand the transfer back so that it resumes (from its checkpoint) elsewhere
+		transfer.SetError("")
+		transfer.SetStatus(domain.TransferStatusPending)
+		w.logger.Info("interrupted transfer", "id", transfer.ID())
+	case err == nil:
+		transfer.SetError("")
+		transfer.SetStatus(domain.TransferStatusSuccess)
+	case errors.Is(err, domain.ErrTransferCanceled):
+		// keep the results of whatever was completed before stopping
+		transfer.SetError("")
+		transfer.SetStatus(domain.TransferStatusCanceled)
+		w.logger.Info("canceled transfer", "id", transfer.ID())
+	default:
+		w.handleFailure(transfer, err)
+	}
+
+	kind, message := outcomeEvent(transfer, err)
+
+	// a finished transfer will never resume its partial upload
+	if transfer.Finished() && transfer.Partial() != nil {
+		err = abortPartial(w.repo, transfer)
 		if err != nil {
-			return err
+			w.logger.Error(err.Error(), "id", transfer.ID())
 		}
+		transfer.SetPartial(nil)
+	}
+
+	transfersProcessed.WithLabelValues(string(transfer.Status())).Inc()
+	err = w.repo.Transfer.Update(transfer)
+	if err != nil {
+		return err
+	}
+
+	w.event(transfer, kind, "", message)
+	return nil
+}
+
+// Append an event to a transfer's timeline (noting that it happened here).
+func (w *Worker) event(transfer *domain.Transfer, kind domain.TransferEventKind, file, message string) {
+	recordEvent(w.logger, w.repo, transfer, w.id, kind, file, message)
+}
+
+// Decide whether a failed transfer should be retried later or given up on.
+func (w *Worker) handleFailure(transfer *domain.Transfer, err error) {
+	transfer.SetError(err.Error())
+
+	if isPermanent(err) {
+		transfer.SetStatus(domain.TransferStatusFailure)
+		return
+	}
+
+	itinerary, err := w.repo.Itinerary.Read(transfer.ItineraryID())
+	if err != nil {
+		transfer.SetStatus(domain.TransferStatusFailure)
+		return
+	}
+
+	retry := itinerary.Retry()
+	if transfer.Attempts() >= retry.MaxAttempts {
+		transfer.SetStatus(domain.TransferStatusFailure)
+		return
+	}
+
+	nextAttemptAt := time.Now().Add(retry.Delay(transfer.Attempts()))
+	transfer.ScheduleRetry(nextAttemptAt)
+
+	w.logger.Info("retrying transfer", "id", transfer.ID(), "next_attempt_at", nextAttemptAt)
+}
+
+// Clean up the destination's storage for a partially-copied file.
+func abortPartial(repo *repository.Repository, transfer *domain.Transfer) error {
+	itinerary, err := repo.Itinerary.Read(transfer.ItineraryID())
+	if err != nil {
+		return err
+	}
+
+	toLocation, err := repo.Location.Read(itinerary.ToLocationID())
+	if err != nil {
+		return err
 	}
+
+	to, err := toLocation.Connect()
+	if err != nil {
+		return err
+	}
+
+	return fileserver.AbortPartial(to, *transfer.Partial())
 }
 
-func (w *Worker) RunTransfer(transfer *domain.Transfer) error {
+func (w *Worker) RunTransfer(ctx context.Context, transfer *domain.Transfer) error {
+	if transfer.CancelRequested() {
+		return domain.ErrTransferCanceled
+	}
+
+	// stop the copy (even mid-stream) as soon as cancellation is requested
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	go w.watchCancel(ctx, transfer.ID(), cancel)
+	go w.keepLease(ctx, transfer, cancel)
+
 	// look up itinerary by ID
 	itinerary, err := w.repo.Itinerary.Read(transfer.ItineraryID())
 	if err != nil {
 		return err
 	}
 
+	// bound how long this run may take (if the itinerary asks for it)
+	if itinerary.MaxDuration() > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, itinerary.MaxDuration(), domain.ErrTransferTimeout)
+		defer cancelTimeout()
+	}
+
 	// look up locations by ID
 	fromLocation, err := w.repo.Location.Read(itinerary.FromLocationID())
 	if err != nil {
@@ -128,23 +388,147 @@ func (w *Worker) RunTransfer(transfer *domain.Transfer) error {
 		return err
 	}
 
-	// run the xfer
-	// TODO: update the transfer (in DB) every N seconds
-	progress, err := fileserver.Transfer(itinerary.Pattern(), from, to)
+	w.event(transfer, domain.TransferEventStarted, "", "")
+
+	// run the xfer (skipping / resuming anything a previous run checkpointed)
+	opts := fileserver.TransferOptions{
+		Conflict: itinerary.Conflict(),
+		Retry:    fileserver.DefaultFileRetryPolicy,
+		Files:    transfer.Files(),
+		Marker:   itinerary.Marker(),
+
+		IdleTimeout: itinerary.IdleTimeout(),
+
+		Completed: transfer.Completed(),
+		Partial:   transfer.Partial(),
+		Limiters: []*rate.Limiter{
+			w.limiter,
+			w.itineraryLimiters.Get(itinerary.ID(), itinerary.MaxBytesPerSecond()),
+			w.locationLimiters.Get(fromLocation.ID(), fromLocation.MaxBytesPerSecond()),
+			w.locationLimiters.Get(toLocation.ID(), toLocation.MaxBytesPerSecond()),
+		},
+		OnStart: func(name string) error {
+			w.event(transfer, domain.TransferEventFileStarted, name, "")
+			return nil
+		},
+		OnResult: func(result fileserver.TransferResult) error {
+			err := w.recordFile(transfer, result, nil)
+			if err != nil {
+				return err
+			}
+
+			w.event(transfer, domain.TransferEventFileCompleted, result.Name, string(result.Action))
+
+			transfer.AddResult(result)
+			transfer.SetPartial(nil)
+			if result.Action != fileserver.ActionSkip {
+				transfer.SetProgress(transfer.Progress() + result.Size)
+			}
+
+			// persist the checkpoint as each file completes
+			return w.repo.Transfer.Update(transfer)
+		},
+		OnPartial: func(partial fileserver.Partial) error {
+			transfer.SetPartial(&partial)
+			return w.repo.Transfer.Update(transfer)
+		},
+		OnFailure: func(result fileserver.TransferResult, err error) error {
+			w.event(transfer, domain.TransferEventFileFailed, result.Name, err.Error())
+			return w.recordFile(transfer, result, err)
+		},
+	}
+	_, err = fileserver.Transfer(ctx, itinerary.Pattern(), from, to, opts)
 	if err != nil {
+		// report why the transfer was stopped early (canceled, lease lost, etc)
+		cause := context.Cause(ctx)
+		if errors.Is(cause, domain.ErrTransferTimeout) {
+			// keep track of the file that was being copied (if any)
+			var fileErr *fileserver.FileError
+			if errors.As(err, &fileErr) {
+				return &fileserver.FileError{Name: fileErr.Name, Err: cause}
+			}
+		}
+		if cause != nil {
+			return cause
+		}
+
 		return err
 	}
 
-	// TODO: update the xfer progress periodically
-	err = transfer.SetProgress(progress)
+	return nil
+}
+
+// Keep a per-file record of how the transfer went.
+func (w *Worker) recordFile(transfer *domain.Transfer, result fileserver.TransferResult, reason error) error {
+	file, err := domain.NewTransferFile(transfer, result, reason)
 	if err != nil {
 		return err
 	}
 
-	err = w.repo.Transfer.Update(transfer)
-	if err != nil {
-		return err
+	return w.repo.TransferFile.Save(file)
+}
+
+// Cancellation can be requested from any process so keep checking the
+// database for it until the transfer is done.
+func (w *Worker) watchCancel(ctx context.Context, id uuid.UUID, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(cancelCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			transfer, err := w.repo.Transfer.Read(id)
+			if err != nil {
+				// log error but keep checking
+				w.logger.Error(err.Error(), "id", id)
+				continue
+			}
+
+			if transfer.CancelRequested() {
+				cancel(domain.ErrTransferCanceled)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
 	}
+}
 
-	return nil
+// Keep renewing the transfer's lease so that the reaper knows this worker is
+// still alive. If the lease has already been lost then stop the transfer.
+func (w *Worker) keepLease(ctx context.Context, transfer *domain.Transfer, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := w.repo.Transfer.RenewLease(transfer, leaseDuration)
+			if err != nil {
+				if errors.Is(err, repository.ErrConflict) {
+					cancel(errLeaseLost)
+					return
+				}
+
+				// log error but keep trying
+				w.logger.Error(err.Error(), "id", transfer.ID())
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Errors that will never succeed no matter how many times they are retried.
+func isPermanent(err error) bool {
+	switch {
+	case fileserver.IsPermanent(err):
+		return true
+	case errors.Is(err, repository.ErrNotExist):
+		return true
+	case errors.Is(err, domain.ErrLocationInvalidKind):
+		return true
+	default:
+		return false
+	}
 }
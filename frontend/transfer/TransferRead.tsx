@@ -1,7 +1,8 @@
-import React from "react";
-import { useQuery } from "@tanstack/react-query";
+import React, { useEffect } from "react";
+import { useQuery, useQueryClient } from "@tanstack/react-query";
 import { useParams } from "react-router";
 
+import type { Transfer, TransferUpdate } from "../types";
 import { readTransfer } from "../fetch";
 
 export default function TransferRead() {
@@ -20,6 +21,29 @@ export default function TransferRead() {
 		queryFn: async () => readTransfer(id),
 	});
 
+	// apply live status and progress updates as the server pushes them
+	const queryClient = useQueryClient();
+	useEffect(() => {
+		const source = new EventSource(`/api/v1/transfer/${id}/stream`);
+		source.addEventListener("transfer", (event) => {
+			const update: TransferUpdate = JSON.parse(event.data);
+			queryClient.setQueryData(["transfer", id], (transfer: Transfer | undefined) => {
+				if (!transfer) {
+					return transfer;
+				}
+
+				return {
+					...transfer,
+					status: update.status,
+					progress: update.progress,
+					updatedAt: update.updatedAt,
+				};
+			});
+		});
+
+		return () => source.close();
+	}, [id, queryClient]);
+
 	// TODO: build a generic loading component
 	if (isPending) {
 		return <div>Loading...</div>;
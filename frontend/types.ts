@@ -74,3 +74,10 @@ export type TransferListResponse = {
 export type TransferReadResponse = {
 	transfer: Transfer;
 };
+
+export type TransferUpdate = {
+	id: string;
+	status: string;
+	progress: number;
+	updatedAt: Date;
+};
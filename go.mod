@@ -8,14 +8,17 @@ require (
 	github.com/BurntSushi/toml v1.4.0
 	github.com/alexedwards/flow v0.1.0
 	github.com/coreos/go-systemd v0.0.0-20191104093116-d3cd4ed1dbcf
+	github.com/fsnotify/fsnotify v1.8.0
 	github.com/google/uuid v1.6.0
 	github.com/jackc/pgerrcode v0.0.0-20240316143900-6e2875d9b438
 	github.com/jackc/pgx/v5 v5.7.1
 	github.com/klauspost/compress v1.17.11
 	github.com/minio/minio-go/v7 v7.0.81
 	github.com/prometheus/client_golang v1.20.5
+	github.com/robfig/cron/v3 v3.0.1
 	golang.org/x/crypto v0.31.0
 	golang.org/x/exp v0.0.0-20241210194714-1829a127f884
+	golang.org/x/time v0.8.0
 )
 
 require (
@@ -35,10 +35,35 @@ func main() {
 func run() int {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [options] [mode]\n\n", os.Args[0])
+		fmt.Fprintf(out, "Modes:\n")
+		fmt.Fprintf(out, "  web     serve the web app and REST API\n")
+		fmt.Fprintf(out, "  worker  run transfers (with a health and metrics listener)\n")
+		fmt.Fprintf(out, "  all     do both in a single process (default)\n\n")
+		fmt.Fprintf(out, "Options:\n")
+		flag.PrintDefaults()
+	}
+
 	conf := flag.String("conf", "dripfile.conf", "app config file")
 	migrateOnly := flag.Bool("migrate", false, "apply migrations and exit")
 	flag.Parse()
 
+	// standalone mode by default
+	mode := "all"
+	if flag.NArg() > 0 {
+		mode = flag.Arg(0)
+	}
+
+	if flag.NArg() > 1 || (mode != "web" && mode != "worker" && mode != "all") {
+		flag.Usage()
+		return 2
+	}
+
+	runWeb := mode == "web" || mode == "all"
+	runWorker := mode == "worker" || mode == "all"
+
 	cfg, err := config.ReadFile(*conf)
 	if err != nil {
 		logger.Error(err.Error())
@@ -76,20 +101,14 @@ func run() int {
 
 	repo := repository.NewPostgres(pool, box)
 
-	// let systemd know that we are good to go (no-op if not using systemd)
-	daemon.SdNotify(false, daemon.SdNotifyReady)
-
 	// create a context that cancels upon receiving an interrupt signal
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
 	var wg sync.WaitGroup
 
-	app := web.NewApplication(
-		logger,
-		distFS,
-		repo,
-	)
+	// each mode is ready once all of its listeners are
+	var ready sync.WaitGroup
 
 	// let port be overridden by an env var
 	port := cfg.Port
@@ -99,31 +118,132 @@ func run() int {
 
 	addr := fmt.Sprintf("%s:%s", cfg.Host, port)
 
-	// start the web server in the background
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+	if runWeb {
+		listener := database.NewListener(logger, cfg.DatabaseURI, repository.TransferUpdatedChannel)
+		app := web.NewApplication(
+			logger,
+			distFS,
+			repo,
+			listener,
+			cfg.MaxUploadBytes,
+			cfg.AllowedLocalRoots,
+		)
+
+		// start the web server in the background
+		ready.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := app.Run(ctx, addr, ready.Done)
+			if err != nil {
+				logger.Error(err.Error())
+			}
+		}()
+	}
 
-		err := app.Run(ctx, addr)
-		if err != nil {
-			logger.Error(err.Error())
+	if runWorker {
+		// the web server already serves health checks and metrics when running both
+		if !runWeb {
+			hs := worker.NewHealthServer(logger)
+
+			// start health server in the background
+			ready.Add(1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				err := hs.Run(ctx, addr, ready.Done)
+				if err != nil {
+					logger.Error(err.Error())
+				}
+			}()
 		}
-	}()
 
-	w := worker.New(logger, repo)
+		listener := database.NewListener(logger, cfg.DatabaseURI, repository.TransferCreatedChannel)
+		w := worker.New(
+			logger,
+			repo,
+			cfg.MaxBytesPerSecond,
+			cfg.MaxConcurrentTransfers,
+			cfg.ShutdownTimeout,
+			listener,
+		)
+
+		// start worker in the background
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := w.Run(ctx)
+			if err != nil {
+				logger.Error(err.Error())
+			}
+		}()
+
+		s := worker.NewScheduler(logger, repo)
+
+		// start scheduler in the background (enqueues transfers for due schedules)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := s.Run(ctx)
+			if err != nil {
+				logger.Error(err.Error())
+			}
+		}()
+
+		p := worker.NewPoller(logger, repo)
+
+		// start poller in the background (enqueues transfers when new files appear)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := p.Run(ctx)
+			if err != nil {
+				logger.Error(err.Error())
+			}
+		}()
+
+		fw := worker.NewWatcher(logger, repo)
+
+		// start watcher in the background (enqueues transfers when local files settle)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := fw.Run(ctx)
+			if err != nil {
+				logger.Error(err.Error())
+			}
+		}()
+
+		rp := worker.NewReaper(logger, repo)
+
+		// start reaper in the background (recovers transfers whose worker died)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := rp.Run(ctx)
+			if err != nil {
+				logger.Error(err.Error())
+			}
+		}()
+	}
 
-	// start worker in the background (standalone mode by default)
-	wg.Add(1)
+	// let systemd know that we are good to go (no-op if not using systemd)
 	go func() {
-		defer wg.Done()
+		ready.Wait()
 
-		err := w.Run(ctx)
-		if err != nil {
-			logger.Error(err.Error())
-		}
+		logger.Info("ready", "mode", mode)
+		daemon.SdNotify(false, daemon.SdNotifyReady)
+		daemon.SdNotify(false, "STATUS=running in "+mode+" mode")
 	}()
 
-	// wait for the worker and web server to stop
+	// wait for everything that was started to stop
 	wg.Wait()
 
 	return 0
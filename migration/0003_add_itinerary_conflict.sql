@@ -0,0 +1,2 @@
+ALTER TABLE itinerary
+    ADD COLUMN conflict text NOT NULL DEFAULT 'overwrite';
@@ -0,0 +1,2 @@
+ALTER TABLE transfer
+    ADD COLUMN results jsonb NOT NULL DEFAULT '[]';
@@ -0,0 +1,2 @@
+ALTER TABLE transfer
+    ADD COLUMN partial jsonb;
@@ -0,0 +1,9 @@
+ALTER TABLE itinerary
+    ADD COLUMN retry_max_attempts integer NOT NULL DEFAULT 3,
+    ADD COLUMN retry_initial_delay interval NOT NULL DEFAULT '30 seconds',
+    ADD COLUMN retry_backoff_factor double precision NOT NULL DEFAULT 2,
+    ADD COLUMN retry_jitter double precision NOT NULL DEFAULT 0.2;
+
+ALTER TABLE transfer
+    ADD COLUMN attempts integer NOT NULL DEFAULT 0,
+    ADD COLUMN next_attempt_at timestamptz;
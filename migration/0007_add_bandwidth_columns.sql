@@ -0,0 +1,5 @@
+ALTER TABLE location
+    ADD COLUMN max_bytes_per_second bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE itinerary
+    ADD COLUMN max_bytes_per_second bigint NOT NULL DEFAULT 0;
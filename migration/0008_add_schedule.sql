@@ -0,0 +1,22 @@
+CREATE TABLE schedule (
+    id uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    expr text NOT NULL,
+    timezone text NOT NULL,
+    next_run_at timestamptz NOT NULL,
+
+    -- metadata columns
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+CREATE INDEX schedule_next_run_at_idx ON schedule (next_run_at);
+
+CREATE TABLE schedule_itinerary (
+    schedule_id uuid NOT NULL REFERENCES schedule(id) ON DELETE CASCADE,
+    itinerary_id uuid NOT NULL REFERENCES itinerary(id) ON DELETE CASCADE,
+    PRIMARY KEY (schedule_id, itinerary_id)
+);
+
+-- transfers enqueued automatically are deduplicated by key
+ALTER TABLE transfer
+    ADD COLUMN idempotency_key text UNIQUE;
@@ -0,0 +1,12 @@
+ALTER TABLE itinerary
+    ADD COLUMN poll_interval interval NOT NULL DEFAULT '0',
+    ADD COLUMN polled_at timestamptz;
+
+-- files that polling has already observed at an itinerary's source
+CREATE TABLE itinerary_seen_file (
+    itinerary_id uuid NOT NULL REFERENCES itinerary(id) ON DELETE CASCADE,
+    name text NOT NULL,
+    size bigint NOT NULL,
+    mod_time timestamptz NOT NULL,
+    PRIMARY KEY (itinerary_id, name)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE itinerary
+    ADD COLUMN trigger_secret bytea;
+
+-- transfers can be narrowed to specific source files
+ALTER TABLE transfer
+    ADD COLUMN files text[];
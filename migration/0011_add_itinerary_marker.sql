@@ -0,0 +1,4 @@
+ALTER TABLE itinerary
+    ADD COLUMN marker_suffix text NOT NULL DEFAULT '',
+    ADD COLUMN marker_action text NOT NULL DEFAULT 'keep',
+    ADD COLUMN marker_complete text NOT NULL DEFAULT '';
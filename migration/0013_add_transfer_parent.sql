@@ -0,0 +1,4 @@
+ALTER TABLE transfer
+    ADD COLUMN parent_id uuid REFERENCES transfer(id) ON DELETE SET NULL;
+
+CREATE INDEX transfer_parent_id_idx ON transfer (parent_id);
@@ -0,0 +1,9 @@
+ALTER TABLE transfer
+    ADD COLUMN lease_expires_at timestamptz;
+
+-- transfers left running by an older version are reaped right away
+UPDATE transfer
+    SET lease_expires_at = now()
+    WHERE status = 'running';
+
+CREATE INDEX transfer_lease_expires_at_idx ON transfer (lease_expires_at) WHERE status = 'running';
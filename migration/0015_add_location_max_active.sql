@@ -0,0 +1,2 @@
+ALTER TABLE location
+    ADD COLUMN max_active integer NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+ALTER TABLE itinerary
+    ADD COLUMN priority integer NOT NULL DEFAULT 0;
+
+ALTER TABLE transfer
+    ADD COLUMN priority integer NOT NULL DEFAULT 0,
+    ADD COLUMN not_before timestamptz;
+
+CREATE INDEX transfer_queue_idx ON transfer (priority DESC, created_at ASC) WHERE status IN ('pending', 'retrying');
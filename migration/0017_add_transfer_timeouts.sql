@@ -0,0 +1,6 @@
+ALTER TABLE itinerary
+    ADD COLUMN max_duration interval NOT NULL DEFAULT '0',
+    ADD COLUMN idle_timeout interval NOT NULL DEFAULT '0';
+
+ALTER TABLE transfer
+    ADD COLUMN stuck_on text NOT NULL DEFAULT '';
@@ -0,0 +1,20 @@
+CREATE TABLE transfer_file (
+    id uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    transfer_id uuid NOT NULL REFERENCES transfer(id) ON DELETE CASCADE,
+    name text NOT NULL,
+    dest text NOT NULL,
+    size bigint NOT NULL,
+    checksum text NOT NULL,
+    status text NOT NULL,
+    error text NOT NULL,
+    attempts integer NOT NULL,
+    started_at timestamptz NOT NULL,
+    finished_at timestamptz NOT NULL,
+
+    -- metadata columns
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL,
+
+    -- later runs of the same transfer update each file's record
+    UNIQUE (transfer_id, name)
+);
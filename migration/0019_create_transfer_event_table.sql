@@ -0,0 +1,13 @@
+CREATE TABLE transfer_event (
+    id uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    transfer_id uuid NOT NULL REFERENCES transfer(id) ON DELETE CASCADE,
+    kind text NOT NULL,
+    worker_id text NOT NULL,
+    file text NOT NULL,
+    message text NOT NULL,
+
+    -- metadata columns (events are append-only)
+    created_at timestamptz NOT NULL
+);
+
+CREATE INDEX transfer_event_transfer_id_created_at_idx ON transfer_event (transfer_id, created_at);
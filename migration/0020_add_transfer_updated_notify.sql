@@ -0,0 +1,24 @@
+-- let anything listening (such as live progress streams) know whenever a
+-- transfer is created or its status or progress changes
+CREATE FUNCTION notify_transfer_updated() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('transfer_updated', json_build_object(
+        'id', NEW.id,
+        'status', NEW.status,
+        'progress', NEW.progress,
+        'updatedAt', NEW.updated_at
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER transfer_inserted_notify
+    AFTER INSERT ON transfer
+    FOR EACH ROW
+    EXECUTE FUNCTION notify_transfer_updated();
+
+CREATE TRIGGER transfer_updated_notify
+    AFTER UPDATE ON transfer
+    FOR EACH ROW
+    WHEN (OLD.status IS DISTINCT FROM NEW.status OR OLD.progress IS DISTINCT FROM NEW.progress)
+    EXECUTE FUNCTION notify_transfer_updated();